@@ -0,0 +1,69 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const redactedValue = "[REDACTED]"
+
+// Always redacted by AccessLog, in addition to the patterns passed to it.
+var defaultRedactedPatterns = []string{"password", "token", "secret"}
+
+// Middleware logging each call at info level with the user id, the duration, the outcome
+// and the data (the logger of LoggerFromContext adds the widget and action names).
+// Values whose key contains one of the redactedPatterns (case insensitive) or one
+// of "password", "token" and "secret" are replaced, at any depth (like inside "formData"),
+// in addition to the keys of WithRedactedKeys, and files are left out.
+func AccessLog(redactedPatterns ...string) ActionMiddleware {
+	patterns := make([]string, 0, len(defaultRedactedPatterns)+len(redactedPatterns))
+	patterns = append(patterns, defaultRedactedPatterns...)
+	for _, pattern := range redactedPatterns {
+		patterns = append(patterns, strings.ToLower(pattern))
+	}
+
+	return func(handler ActionHandler) ActionHandler {
+		return func(ctx context.Context, data Data) (string, string, []byte, error) {
+			start := time.Now()
+			redirect, templateName, resData, err := handler(ctx, data)
+
+			// an invalid or missing id is handled as anonymous
+			userId, _ := GetCurrentUserId(data)
+			fields := []zap.Field{
+				zap.Uint64("userId", userId), zap.Duration("duration", time.Since(start)),
+				zap.Any("data", redactForLogging(data, redactedKeysFromContext(ctx), patterns)),
+			}
+			switch {
+			case err != nil:
+				fields = append(fields, zap.String("outcome", "error"), zap.Error(err))
+			case redirect != "":
+				fields = append(fields, zap.String("outcome", "redirect"), zap.String("redirect", redirect))
+			default:
+				fields = append(fields, zap.String("outcome", "success"), zap.String("templateName", templateName), zap.Int("size", len(resData)))
+			}
+			LoggerFromContext(ctx).Info("Action called", fields...)
+			return redirect, templateName, resData, err
+		}
+	}
+}
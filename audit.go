@@ -0,0 +1,137 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	AuditSuccess  = "success"
+	AuditRedirect = "redirect"
+	AuditError    = "error"
+)
+
+// Record of a call to an action with Audited.
+type AuditRecord struct {
+	WidgetName string
+	ActionName string
+	UserId     uint64 // 0 for an anonymous call
+	Time       time.Time
+	ParamsHash string // hex encoded sha256 of the data (without files) and of the files (names, filenames and contents)
+	Outcome    string // one of AuditSuccess, AuditRedirect or AuditError
+	Redirect   string
+	Error      string
+}
+
+// AuditSink store the audit trail (a database table, a log stream, etc.).
+type AuditSink interface {
+	Record(ctx context.Context, record AuditRecord) error
+}
+
+// Send a record of each call to the actions with Audited to sink (after the handler, whatever the outcome).
+func WithAuditSink(sink AuditSink) Option {
+	return func(o *serverOptions) {
+		o.audit = sink
+	}
+}
+
+// Report each call of the action to the AuditSink of the server (see WithAuditSink),
+// intended for the state-changing actions.
+func Audited() ActionOption {
+	return func(a *action) {
+		a.audited = true
+	}
+}
+
+// computed before calling the handler (it could change data), the files sent with Process
+// and with Upload are both hashed
+func hashParams(data Data) (string, error) {
+	params := make(Data, len(data))
+	for key, value := range data {
+		if key != FilesKey && key != FilePartsKey {
+			params[key] = value
+		}
+	}
+
+	hash := sha256.New()
+	// map keys are sorted by the json encoding, so the hash is stable
+	if err := json.NewEncoder(hash).Encode(params); err != nil {
+		return "", err
+	}
+
+	parts, err := GetFileParts(data)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(parts))
+	for name := range parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		part := parts[name]
+		hash.Write([]byte(name))
+		hash.Write([]byte{0})
+		hash.Write([]byte(part.Filename))
+		hash.Write([]byte{0})
+		if err = hashFilePart(hash, part); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashFilePart(dest io.Writer, part FilePart) error {
+	reader, err := part.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(dest, reader)
+	return err
+}
+
+// userId is read before calling the handler, which could still use data after an abandon (see callHandlerWithDeadline)
+func (s widgetServerAdapter) recordAudit(ctx context.Context, widgetName string, actionName string, userId uint64, paramsHash string, redirect string, err error) {
+	record := AuditRecord{
+		WidgetName: widgetName, ActionName: actionName, UserId: userId, Time: time.Now(), ParamsHash: paramsHash, Outcome: AuditSuccess,
+	}
+	switch {
+	case err != nil:
+		record.Outcome = AuditError
+		record.Error = err.Error()
+	case redirect != "":
+		record.Outcome = AuditRedirect
+		record.Redirect = redirect
+	}
+
+	if err := s.options.audit.Record(ctx, record); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to record audit", requestIdField(ctx), zap.Error(err))
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import "testing"
+
+func TestHashParams(t *testing.T) {
+	base := Data{FormKey: map[string]any{"name": "Ada"}, FilePartsKey: map[string]FilePart{
+		"avatar": {Name: "avatar", Filename: "ada.png", content: []byte("first")},
+	}}
+	sameHash, err := hashParams(Data{FormKey: map[string]any{"name": "Ada"}, FilePartsKey: map[string]FilePart{
+		"avatar": {Name: "avatar", Filename: "ada.png", content: []byte("first")},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	baseHash, err := hashParams(base)
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	if baseHash != sameHash {
+		t.Errorf("got different hashes for the same parameters")
+	}
+
+	tests := []struct {
+		name string
+		data Data
+	}{
+		{name: "form", data: Data{FormKey: map[string]any{"name": "Bob"}, FilePartsKey: base[FilePartsKey]}},
+		{name: "file content", data: Data{FormKey: base[FormKey], FilePartsKey: map[string]FilePart{
+			"avatar": {Name: "avatar", Filename: "ada.png", content: []byte("second")},
+		}}},
+		{name: "file name", data: Data{FormKey: base[FormKey], FilePartsKey: map[string]FilePart{
+			"avatar": {Name: "avatar", Filename: "bob.png", content: []byte("first")},
+		}}},
+	}
+	for _, tt := range tests {
+		got, err := hashParams(tt.data)
+		if err != nil {
+			t.Fatalf("%s : unexpected error : %v", tt.name, err)
+		}
+		if got == baseHash {
+			t.Errorf("%s : got the same hash for different parameters", tt.name)
+		}
+	}
+
+	if _, err = hashParams(Data{FormKey: map[string]any{"callback": func() {}}}); err == nil {
+		t.Error("got no error for a value json can not encode")
+	}
+}
@@ -0,0 +1,47 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrUnauthenticated = status.Error(codes.Unauthenticated, "authentication required")
+
+// Redirect target of the anonymous calls to the actions with RequireAuthenticated.
+func WithLoginUrl(loginUrl string) Option {
+	return func(o *serverOptions) {
+		o.loginUrl = loginUrl
+	}
+}
+
+// Skip the handler for anonymous calls (when GetCurrentUserId fails) : they are redirected
+// to the url from WithLoginUrl, or rejected with ErrUnauthenticated when the server has none.
+func RequireAuthenticated() ActionOption {
+	return func(a *action) {
+		a.authenticated = true
+	}
+}
+
+// Like AddAction with the RequireAuthenticated option.
+func (w Widget) AddProtectedAction(actionName string, kind pb.MethodKind, path string, handler ActionHandler, opts ...ActionOption) {
+	w.addAction(actionName, action{kind: kind, path: path, handler: handler, authenticated: true}, opts)
+}
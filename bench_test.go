@@ -0,0 +1,130 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func benchmarkProcess(b *testing.B, s WidgetServer, actionName string, data Data) {
+	b.Helper()
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		b.Fatal(err)
+	}
+	handler := s.Handler()
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), &testTransportStream{header: metadata.MD{}})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		request := &pb.ProcessRequest{
+			WidgetName: "bench", ActionName: actionName, Files: map[string][]byte{dataKey: dataBytes},
+		}
+		if _, err = handler.Process(ctx, request); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkData() Data {
+	return Data{
+		CurrentUrlKey: "http://site.test/bench/view", UserIdKey: 12, LocaleKey: "en",
+		FormKey: map[string]any{"name": "Ada", "email": "ada@site.test", "age": "36"},
+	}
+}
+
+func BenchmarkProcess(b *testing.B) {
+	s := newTestServer(b)
+	s.CreateWidget("bench").AddAction("view", pb.MethodKind_GET, "/view", noopHandler)
+
+	benchmarkProcess(b, s, "view", benchmarkData())
+}
+
+func BenchmarkProcessDataAction(b *testing.B) {
+	s := newTestServer(b)
+	s.CreateWidget("bench").AddDataAction("view", pb.MethodKind_GET, "/view", func(ctx context.Context, data Data) (string, string, Data, error) {
+		return "", "view", Data{"items": []string{"a", "b", "c"}, "total": 3}, nil
+	})
+
+	benchmarkProcess(b, s, "view", benchmarkData())
+}
+
+func BenchmarkProcessAudited(b *testing.B) {
+	s := newTestServer(b, WithAuditSink(discardAuditSink{}))
+	s.CreateWidget("bench").AddAction("save", pb.MethodKind_POST, "/save", noopHandler, Audited())
+
+	benchmarkProcess(b, s, "save", benchmarkData())
+}
+
+type discardAuditSink struct{}
+
+func (discardAuditSink) Record(ctx context.Context, record AuditRecord) error {
+	return nil
+}
+
+func BenchmarkProcessStream(b *testing.B) {
+	s := newTestServer(b)
+	body := []byte(strings.Repeat("streamed line\n", 10000))
+	s.CreateWidget("bench").AddStreamAction("export", "/export", nil, func(ctx context.Context, data Data, out io.Writer) error {
+		_, err := out.Write(body)
+		return err
+	})
+	dataBytes, err := json.Marshal(benchmarkData())
+	if err != nil {
+		b.Fatal(err)
+	}
+	adapter := s.adapter()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stream := discardServerStream{testServerStream: newTestServerStream(context.Background())}
+		request := &pb.ProcessRequest{WidgetName: "bench", ActionName: "export", Files: map[string][]byte{dataKey: dataBytes}}
+		if err = adapter.ProcessStream(request, stream); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// measure the server without the copies of testServerStream
+type discardServerStream struct {
+	*testServerStream
+}
+
+func (discardServerStream) SendMsg(m any) error {
+	return nil
+}
+
+func BenchmarkProcessValidated(b *testing.B) {
+	s := newTestServer(b, WithResponseValidation())
+	s.CreateWidget("bench").AddDataAction("view", pb.MethodKind_GET, "/view", func(ctx context.Context, data Data) (string, string, Data, error) {
+		return "", "view", Data{"items": []string{"a", "b", "c"}, "total": 3}, nil
+	})
+
+	benchmarkProcess(b, s, "view", benchmarkData())
+}
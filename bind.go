@@ -0,0 +1,230 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const formTag = "form"
+
+var timeType = reflect.TypeOf(time.Time{})
+var durationType = reflect.TypeOf(time.Duration(0))
+
+var errBindTarget = errors.New("bind target must be a non nil pointer to a struct")
+var errOverflow = errors.New("value overflows the field type")
+var errUnsupportedField = errors.New("unsupported field type")
+
+// Aggregation of the errors of several fields.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		messages = append(messages, fieldError.Error())
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Fill the fields of the struct pointed by target with the entries of values, the entry name is
+// read from the `form:"name"` tag (default to the field name, "-" to ignore the field).
+// Conversions use the As* helpers, missing entries leave the field untouched
+// and the errors of all fields are returned in a FieldErrors.
+func Bind(values Data, target any) error {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Pointer || targetValue.IsNil() || targetValue.Elem().Kind() != reflect.Struct {
+		return errBindTarget
+	}
+	if errs := bindStruct(values, targetValue.Elem(), ""); len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// Bind the "formData" entry of data (the submitted form) to target, see Bind.
+// A pointer field is an optional one : it stays nil when its entry is absent or an empty string.
+func BindForm(data Data, target any) error {
+	formData, err := GetFormData(data)
+	if err != nil {
+		return err
+	}
+	return Bind(formData, target)
+}
+
+// Convert a slice of maps into a slice of T (a struct type) with Bind,
+// the error indicates the index of the first failing element.
+func BindSlice[T any](value any) ([]T, error) {
+	maps, err := AsSliceOfMaps(value)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]T, len(maps))
+	for i, m := range maps {
+		if err := Bind(m, &res[i]); err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	return res, nil
+}
+
+func bindStruct(values Data, structValue reflect.Value, prefix string) FieldErrors {
+	var errs FieldErrors
+	structType := structValue.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup(formTag); ok {
+			if tag == "-" {
+				continue
+			}
+			if tagName, _, _ := strings.Cut(tag, ","); tagName != "" {
+				name = tagName
+			}
+		}
+
+		value := values[name]
+		if value == nil {
+			continue
+		}
+		errs = append(errs, setField(structValue.Field(i), value, prefix+name)...)
+	}
+	return errs
+}
+
+func setField(fieldValue reflect.Value, value any, name string) FieldErrors {
+	var err error
+	switch fieldValue.Type() {
+	case timeType:
+		var t time.Time
+		if t, err = AsTime(value); err == nil {
+			fieldValue.Set(reflect.ValueOf(t))
+		}
+		return fieldErrorOf(err, name)
+	case durationType:
+		var d time.Duration
+		if d, err = AsDuration(value); err == nil {
+			fieldValue.SetInt(int64(d))
+		}
+		return fieldErrorOf(err, name)
+	}
+
+	switch fieldValue.Kind() {
+	case reflect.String:
+		var s string
+		if s, err = AsString(value); err == nil {
+			fieldValue.SetString(s)
+		}
+	case reflect.Bool:
+		var b bool
+		if b, err = AsBool(value); err == nil {
+			fieldValue.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = AsInt64(value); err == nil {
+			if fieldValue.OverflowInt(i) {
+				err = errOverflow
+			} else {
+				fieldValue.SetInt(i)
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		if u, err = AsUint64(value); err == nil {
+			if fieldValue.OverflowUint(u) {
+				err = errOverflow
+			} else {
+				fieldValue.SetUint(u)
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = AsFloat64(value); err == nil {
+			if fieldValue.OverflowFloat(f) {
+				err = errOverflow
+			} else {
+				fieldValue.SetFloat(f)
+			}
+		}
+	case reflect.Pointer:
+		if s, ok := value.(string); ok && s == "" {
+			// empty input of an optional field
+			return nil
+		}
+		elemValue := reflect.New(fieldValue.Type().Elem())
+		errs := setField(elemValue.Elem(), value, name)
+		if len(errs) == 0 {
+			fieldValue.Set(elemValue)
+		}
+		return errs
+	case reflect.Struct:
+		var m Data
+		if m, err = AsMap(value); err == nil {
+			return bindStruct(m, fieldValue, name+".")
+		}
+	case reflect.Slice:
+		var s []any
+		if s, err = AsSlice(value); err == nil {
+			sliceValue := reflect.MakeSlice(fieldValue.Type(), len(s), len(s))
+			var errs FieldErrors
+			for i, elem := range s {
+				if elem == nil {
+					continue
+				}
+				errs = append(errs, setField(sliceValue.Index(i), elem, fmt.Sprint(name, "[", i, "]"))...)
+			}
+			if len(errs) != 0 {
+				return errs
+			}
+			fieldValue.Set(sliceValue)
+		}
+	case reflect.Interface:
+		valueValue := reflect.ValueOf(value)
+		if valueValue.Type().AssignableTo(fieldValue.Type()) {
+			fieldValue.Set(valueValue)
+		} else {
+			err = errUnsupportedField
+		}
+	case reflect.Map:
+		valueValue := reflect.ValueOf(value)
+		if valueValue.Type().AssignableTo(fieldValue.Type()) {
+			fieldValue.Set(valueValue)
+		} else {
+			err = errNotMap
+		}
+	default:
+		err = errUnsupportedField
+	}
+
+	return fieldErrorOf(err, name)
+}
+
+func fieldErrorOf(err error, name string) FieldErrors {
+	if err != nil {
+		return FieldErrors{{Field: name, Message: err.Error()}}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type bindSliceItem struct {
+	Name     string `form:"name"`
+	Quantity int64  `form:"quantity"`
+}
+
+func TestBindSlice(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     any
+		want      []bindSliceItem
+		wantIndex string
+		wantCause error
+	}{
+		{
+			name: "clean",
+			value: []any{
+				map[string]any{"name": "apple", "quantity": float64(3)},
+				map[string]any{"name": "pear", "quantity": "12"},
+			},
+			want: []bindSliceItem{{Name: "apple", Quantity: 3}, {Name: "pear", Quantity: 12}},
+		},
+		{name: "empty", value: []any{}, want: []bindSliceItem{}},
+		{
+			name: "mismatched element",
+			value: []any{
+				map[string]any{"name": "apple", "quantity": float64(3)},
+				map[string]any{"name": "pear", "quantity": true},
+			},
+			wantIndex: "element 1",
+		},
+		{
+			name:      "fractional quantity",
+			value:     []any{map[string]any{"name": "apple", "quantity": 2.5}},
+			wantIndex: "element 0", wantCause: errNotInt,
+		},
+		{
+			name:      "overflowing quantity",
+			value:     []any{map[string]any{"name": "apple", "quantity": 1e19}},
+			wantIndex: "element 0", wantCause: errIntOverflow,
+		},
+		{name: "not a slice", value: "apple", wantIndex: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BindSlice[bindSliceItem](tt.value)
+			if tt.want != nil {
+				if err != nil {
+					t.Fatalf("unexpected error : %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("got %v, want an error", got)
+			}
+			if !strings.HasPrefix(err.Error(), tt.wantIndex) {
+				t.Errorf("got error %q, want it to start with %q", err, tt.wantIndex)
+			}
+			if tt.wantCause != nil && !strings.HasSuffix(err.Error(), tt.wantCause.Error()) {
+				t.Errorf("got error %q, want it to end with %q", err, tt.wantCause)
+			}
+		})
+	}
+}
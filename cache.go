@@ -0,0 +1,71 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const cacheControlName = "Cache-Control"
+
+// directive sent when the handler does not call SetCacheControl
+const noCacheDirective = "no-cache"
+
+// the mutex protects from an handler still running after a timeout
+type cacheDirective struct {
+	mutex sync.Mutex
+	value string
+}
+
+// Allow the frontend to cache the response of the current call during maxAge (private restricts
+// the caching to the user browser). The directive is sent as a "puzzle-cache-control" header metadata
+// with the successful response (the last call wins), without it "no-cache" is sent.
+func SetCacheControl(ctx context.Context, maxAge time.Duration, private bool) {
+	if directive, ok := ctx.Value(cacheContextKey).(*cacheDirective); ok {
+		visibility := "public"
+		if private {
+			visibility = "private"
+		}
+		directive.set(visibility + ", max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10))
+	}
+}
+
+func (d *cacheDirective) set(value string) {
+	d.mutex.Lock()
+	d.value = value
+	d.mutex.Unlock()
+}
+
+func (d *cacheDirective) get() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.value == "" {
+		return noCacheDirective
+	}
+	return d.value
+}
+
+func contextWithCacheDirective(ctx context.Context) (context.Context, *cacheDirective) {
+	directive := &cacheDirective{}
+	return context.WithValue(ctx, cacheContextKey, directive), directive
+}
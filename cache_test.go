@@ -0,0 +1,64 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+func publicCacheHandler(ctx context.Context, data Data) (string, string, []byte, error) {
+	SetCacheControl(ctx, time.Minute, false)
+	return "", "", nil, nil
+}
+
+func privateCacheHandler(ctx context.Context, data Data) (string, string, []byte, error) {
+	SetCacheControl(ctx, time.Minute, false)
+	SetCacheControl(ctx, 90*time.Second, true)
+	return "", "", nil, nil
+}
+
+func TestSetCacheControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler ActionHandler
+		want    string
+	}{
+		{name: "default", handler: noopHandler, want: "no-cache"},
+		{name: "public", handler: publicCacheHandler, want: "public, max-age=60"},
+		{name: "last call wins", handler: privateCacheHandler, want: "private, max-age=90"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.CreateWidget("test").AddAction("view", pb.MethodKind_GET, "/view", tt.handler)
+
+			_, header, err := invoke(context.Background(), s, "test", "view", Data{})
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if got := header.Get("puzzle-cache-control"); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("got %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
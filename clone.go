@@ -0,0 +1,189 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Return a deep copy of data : nested maps, slices and files are copied (pointers are kept), so the copy can be
+// used by other goroutines or kept after the call without sharing anything with the original.
+func CloneData(data Data) Data {
+	if data == nil {
+		return nil
+	}
+	res := make(Data, len(data))
+	for key, value := range data {
+		res[key] = cloneValue(value)
+	}
+	return res
+}
+
+func cloneValue(value any) any {
+	switch casted := value.(type) {
+	case Data:
+		return CloneData(casted)
+	case []any:
+		if casted == nil {
+			return casted
+		}
+		res := make([]any, len(casted))
+		for i, elem := range casted {
+			res[i] = cloneValue(elem)
+		}
+		return res
+	case []Data:
+		if casted == nil {
+			return casted
+		}
+		res := make([]Data, len(casted))
+		for i, elem := range casted {
+			res[i] = CloneData(elem)
+		}
+		return res
+	case []byte:
+		if casted == nil {
+			return casted
+		}
+		return append([]byte(nil), casted...)
+	case []string:
+		if casted == nil {
+			return casted
+		}
+		return append([]string(nil), casted...)
+	case []Flash:
+		if casted == nil {
+			return casted
+		}
+		return append([]Flash(nil), casted...)
+	case map[string]string:
+		if casted == nil {
+			return casted
+		}
+		res := make(map[string]string, len(casted))
+		for key, elem := range casted {
+			res[key] = elem
+		}
+		return res
+	case map[string][]byte:
+		if casted == nil {
+			return casted
+		}
+		res := make(map[string][]byte, len(casted))
+		for name, content := range casted {
+			res[name] = append([]byte(nil), content...)
+		}
+		return res
+	case map[string]FilePart:
+		if casted == nil {
+			return casted
+		}
+		// FilePart is only read
+		res := make(map[string]FilePart, len(casted))
+		for name, part := range casted {
+			res[name] = part
+		}
+		return res
+	}
+	// other slices and maps (like []uint64 or map[string]int) are copied with reflection,
+	// strings, numbers and bools are immutable
+	return cloneReflect(value)
+}
+
+func cloneReflect(value any) any {
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Slice:
+		if reflected.IsNil() {
+			return value
+		}
+		res := reflect.MakeSlice(reflected.Type(), reflected.Len(), reflected.Len())
+		for i := 0; i < reflected.Len(); i++ {
+			setCloned(res.Index(i), reflected.Index(i))
+		}
+		return res.Interface()
+	case reflect.Map:
+		if reflected.IsNil() {
+			return value
+		}
+		res := reflect.MakeMapWithSize(reflected.Type(), reflected.Len())
+		iter := reflected.MapRange()
+		for iter.Next() {
+			elem := reflect.New(reflected.Type().Elem()).Elem()
+			setCloned(elem, iter.Value())
+			res.SetMapIndex(iter.Key(), elem)
+		}
+		return res.Interface()
+	}
+	return value
+}
+
+func setCloned(dest reflect.Value, source reflect.Value) {
+	// a nil interface stays at the zero value of dest
+	if cloned := cloneValue(source.Interface()); cloned != nil {
+		dest.Set(reflect.ValueOf(cloned))
+	}
+}
+
+// Read-only view of Data, safe to share between goroutines : it is built from a copy
+// and gives only copies of the nested maps and slices.
+type DataView struct {
+	data Data
+}
+
+// Make a read-only view from a copy of data (see CloneData).
+func ReadOnly(data Data) DataView {
+	return DataView{data: CloneData(data)}
+}
+
+// Return a copy of the value of key (nil when absent).
+func (v DataView) Get(key string) any {
+	return cloneValue(v.data[key])
+}
+
+// Return a view of the nested map at key (empty when absent or not a map), without copy.
+func (v DataView) View(key string) DataView {
+	nested, _ := v.data[key].(Data)
+	return DataView{data: nested}
+}
+
+func (v DataView) Has(key string) bool {
+	_, ok := v.data[key]
+	return ok
+}
+
+func (v DataView) Len() int {
+	return len(v.data)
+}
+
+// Return the keys sorted.
+func (v DataView) Keys() []string {
+	keys := make([]string, 0, len(v.data))
+	for key := range v.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Return a modifiable copy of the viewed data.
+func (v DataView) Clone() Data {
+	return CloneData(v.data)
+}
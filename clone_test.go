@@ -0,0 +1,89 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func cloneTestData() Data {
+	return Data{
+		"name":    "Ada",
+		"nested":  Data{"list": []any{1, Data{"a": "b"}}},
+		"any":     map[string]any{"list": []any{"x"}},
+		"rows":    []Data{{"id": 1}},
+		"tags":    []string{"a", "b"},
+		"flashes": []Flash{{Level: "info", Message: "saved"}},
+		"labels":  map[string]string{"a": "b"},
+		"bytes":   []byte("abc"),
+		"files":   map[string][]byte{"f": []byte("content")},
+		"ids":     []uint64{1, 2},
+		"counts":  map[string]int{"a": 1},
+		"matrix":  [][]int{{1, 2}, nil},
+		"empty":   []string(nil),
+	}
+}
+
+func TestCloneData(t *testing.T) {
+	original := cloneTestData()
+	cloned := CloneData(original)
+	if !reflect.DeepEqual(cloned, original) {
+		t.Fatalf("got %v, want %v", cloned, original)
+	}
+
+	cloned["nested"].(Data)["list"].([]any)[1].(Data)["a"] = "changed"
+	cloned["any"].(map[string]any)["list"].([]any)[0] = "changed"
+	cloned["rows"].([]Data)[0]["id"] = 2
+	cloned["tags"].([]string)[0] = "changed"
+	cloned["flashes"].([]Flash)[0].Message = "changed"
+	cloned["labels"].(map[string]string)["a"] = "changed"
+	cloned["bytes"].([]byte)[0] = 'z'
+	cloned["files"].(map[string][]byte)["f"][0] = 'z'
+	cloned["ids"].([]uint64)[0] = 3
+	cloned["counts"].(map[string]int)["a"] = 2
+	cloned["matrix"].([][]int)[0][0] = 3
+
+	if want := cloneTestData(); !reflect.DeepEqual(original, want) {
+		t.Errorf("original modified through the copy : got %v, want %v", original, want)
+	}
+	if CloneData(nil) != nil {
+		t.Error("copy of nil should be nil")
+	}
+}
+
+func TestDataView(t *testing.T) {
+	original := cloneTestData()
+	view := ReadOnly(original)
+	original["name"] = "changed"
+
+	if name := view.Get("name"); name != "Ada" {
+		t.Errorf("view follows the original : got %v", name)
+	}
+	view.Get("tags").([]string)[0] = "changed"
+	if tag := view.Get("tags").([]string)[0]; tag != "a" {
+		t.Errorf("view modified through Get : got %v", tag)
+	}
+	if !view.Has("nested") || view.Has("missing") || view.Len() != len(original) {
+		t.Error("unexpected Has or Len result")
+	}
+	if list := view.View("nested").Get("list"); len(list.([]any)) != 2 {
+		t.Errorf("unexpected nested view : %v", list)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+var errTrailingData = errors.New("invalid character after top-level value")
+
+// Codec encode and decode the data exchanged with the frontend, the configurations of
+// github.com/json-iterator/go (like jsoniter.ConfigCompatibleWithStandardLibrary)
+// and github.com/bytedance/sonic (like sonic.ConfigStd) can be used directly.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// Codec based on encoding/json (the default one), without html escaping since the template engine escapes.
+// With UseNumber, the numbers are decoded as json.Number instead of float64, so 64 bits identifiers
+// keep their precision (the As* helpers accept both).
+type StdCodec struct {
+	UseNumber bool
+}
+
+func (StdCodec) Marshal(v any) ([]byte, error) {
+	return encodeValue(v)
+}
+
+func (c StdCodec) Unmarshal(data []byte, v any) error {
+	if !c.UseNumber {
+		return json.Unmarshal(data, v)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	// same as json.Unmarshal, which reject trailing data
+	if _, err := decoder.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+// Codec used to decode the data of Process calls and to encode the results of AddDataAction handlers
+// (see MarshalData).
+func WithCodec(codec Codec) Option {
+	return func(o *serverOptions) {
+		o.codec = codec
+	}
+}
+
+// Decode the data of Process calls with StdCodec and UseNumber.
+func WithUseNumber() Option {
+	return WithCodec(StdCodec{UseNumber: true})
+}
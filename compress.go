@@ -0,0 +1,77 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// metadata sent by the frontend with the compressions it can undo
+const acceptCompressionHeader = headerPrefix + "accept-compression"
+
+// sent as "puzzle-data-compression"
+const dataCompressionName = "Data-Compression"
+
+const gzipCompression = "gzip"
+
+var gzipWriterPool = sync.Pool{New: func() any {
+	return gzip.NewWriter(nil)
+}}
+
+// Compress with gzip the response data bigger than threshold bytes when the frontend lists "gzip"
+// in the "puzzle-accept-compression" metadata of the call, the compression is then indicated
+// by the "puzzle-data-compression" header metadata.
+func WithResponseCompression(threshold int) Option {
+	return func(o *serverOptions) {
+		o.compressionThreshold = threshold
+	}
+}
+
+func acceptGzip(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get(acceptCompressionHeader) {
+		for _, accepted := range strings.Split(value, ",") {
+			if strings.TrimSpace(accepted) == gzipCompression {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func gzipData(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(writer)
+
+	writer.Reset(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,58 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Returned when the server already runs its maximum of concurrent actions, the call can be retried later.
+var ErrOverloaded = status.Error(codes.ResourceExhausted, "too many concurrent actions")
+
+// Limit the number of Process (and ProcessStream or Upload) calls handled at the same time (zero means no limit),
+// the calls beyond it fail fast with ErrOverloaded instead of waiting.
+func WithMaxConcurrentActions(limit int) Option {
+	return func(o *serverOptions) {
+		if limit <= 0 {
+			o.actionSlots = nil
+			return
+		}
+		o.actionSlots = make(chan struct{}, limit)
+	}
+}
+
+// return false without waiting when all the slots are taken, release must be called after a success
+func acquireActionSlot(slots chan struct{}) bool {
+	if slots == nil {
+		return true
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func releaseActionSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
@@ -0,0 +1,57 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import "context"
+
+type contextKey int
+
+const (
+	userIdContextKey contextKey = iota
+	localizerContextKey
+	eventContextKey
+	requestIdContextKey
+	cacheContextKey
+	loggerContextKey
+	permissionContextKey
+	jobContextKey
+	redactionContextKey
+	dataEncodingContextKey
+)
+
+// Place the user id (from the "Id" entry) on the context of each call before invoking the handler
+// (see UserIdFromContext).
+func WithUserIdInContext() Option {
+	return func(o *serverOptions) {
+		o.userIdInContext = true
+	}
+}
+
+// Return the user id placed by Process (when the server uses WithUserIdInContext),
+// the boolean is false for anonymous calls.
+func UserIdFromContext(ctx context.Context) (uint64, bool) {
+	userId, _ := ctx.Value(userIdContextKey).(uint64)
+	return userId, userId != 0
+}
+
+func contextWithUserId(ctx context.Context, data Data) context.Context {
+	// an invalid or missing id is handled as anonymous
+	userId, _ := GetCurrentUserId(data)
+	return context.WithValue(ctx, userIdContextKey, userId)
+}
@@ -0,0 +1,289 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidCronSpec = errors.New("invalid cron spec")
+
+// give up searching the next run of a spec which never matches (like "0 0 30 2 *")
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// standard cron fields, a bit by allowed value
+type cronSchedule struct {
+	minutes    uint64
+	hours      uint64
+	days       uint64
+	months     uint64
+	weekDays   uint64
+	anyDay     bool
+	anyWeekDay bool
+}
+
+type cronField struct {
+	min uint
+	max uint
+}
+
+var cronFields = [5]cronField{{min: 0, max: 59}, {min: 0, max: 23}, {min: 1, max: 31}, {min: 1, max: 12}, {min: 0, max: 6}}
+
+type scheduledTask struct {
+	name     string
+	schedule cronSchedule
+	task     func(context.Context) error
+}
+
+// run the scheduled tasks of all the widgets between the start and the shutdown of the server
+type scheduler struct {
+	mutex   sync.Mutex
+	logger  *otelzap.Logger
+	tracer  trace.Tracer
+	tasks   []scheduledTask
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started bool
+	running sync.WaitGroup
+}
+
+func newScheduler(logger *otelzap.Logger, tracer trace.Tracer, codec Codec) *scheduler {
+	ctx, cancel := context.WithCancel(contextWithCodec(context.Background(), codec))
+	return &scheduler{logger: logger, tracer: tracer, ctx: ctx, cancel: cancel}
+}
+
+// Run task periodically according to cronSpec, in the standard five fields format
+// ("minute hour day-of-month month day-of-week", with "*", lists, ranges and steps like "*/15" or "1-5")
+// and in local time. The runs begin with the server (or immediately when it already runs), they do not overlap
+// and each one is traced in a "scheduled.task" span. The context of the task is cancelled by the shutdown,
+// which waits for the current runs (until its timeout).
+// An invalid cronSpec is a wiring mistake and cause a panic (with an error wrapping ErrInvalidCronSpec).
+func (w Widget) AddScheduledTask(name string, cronSpec string, task func(context.Context) error) {
+	schedule, err := parseCronSpec(cronSpec)
+	if err != nil {
+		panic(err)
+	}
+	w.scheduler.add(scheduledTask{name: name, schedule: schedule, task: task})
+}
+
+func (s *scheduler) add(task scheduledTask) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tasks = append(s.tasks, task)
+	if s.started {
+		s.launch(task)
+	}
+}
+
+func (s *scheduler) start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, task := range s.tasks {
+		s.launch(task)
+	}
+}
+
+// should be called with the lock held
+func (s *scheduler) launch(task scheduledTask) {
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+
+		for {
+			now := time.Now()
+			next, ok := task.schedule.next(now)
+			if !ok {
+				s.logger.Warn("Scheduled task never runs", zap.String("task", task.name))
+				return
+			}
+
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-s.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				s.run(task)
+			}
+		}
+	}()
+}
+
+func (s *scheduler) run(task scheduledTask) {
+	ctx, span := s.tracer.Start(s.ctx, "scheduled.task", trace.WithAttributes(attribute.String("task", task.name)))
+	defer span.End()
+
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.ErrorContext(ctx, "Recovered panic in scheduled task", zap.String("task", task.name), zap.Any("panic", r))
+			span.SetStatus(otelcodes.Error, "panic")
+		}
+	}()
+
+	if err := task.task(ctx); err != nil {
+		s.logger.ErrorContext(ctx, "Scheduled task failed", zap.String("task", task.name), zap.Error(err))
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+}
+
+// cancel the tasks and wait for the current runs until ctx is done
+func (s *scheduler) stop(ctx context.Context) error {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// first matching minute strictly after from, false when there is none in a few years
+func (c cronSchedule) next(from time.Time) (time.Time, bool) {
+	t := from.Truncate(time.Minute).Add(time.Minute)
+	limit := from.Add(cronSearchLimit)
+	for t.Before(limit) {
+		switch {
+		case c.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// like the standard cron, when both day fields are restricted, matching one of them is enough
+func (c cronSchedule) matchDay(t time.Time) bool {
+	dayMatch := c.days&(1<<uint(t.Day())) != 0
+	weekDayMatch := c.weekDays&(1<<uint(t.Weekday())) != 0
+	if c.anyDay || c.anyWeekDay {
+		return dayMatch && weekDayMatch
+	}
+	return dayMatch || weekDayMatch
+}
+
+func parseCronSpec(spec string) (cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return cronSchedule{}, fmt.Errorf("%w : %q must have %d fields", ErrInvalidCronSpec, spec, len(cronFields))
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		fieldBits, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("%w : %q, %v", ErrInvalidCronSpec, spec, err)
+		}
+		bits[i] = fieldBits
+	}
+	weekDays := bits[4]
+	if weekDays&(1<<7) != 0 {
+		// sunday written 7
+		weekDays = weekDays&^(1<<7) | 1
+	}
+	return cronSchedule{
+		minutes: bits[0], hours: bits[1], days: bits[2], months: bits[3], weekDays: weekDays,
+		anyDay: fields[2] == "*", anyWeekDay: fields[4] == "*",
+	}, nil
+}
+
+// handle "*", "a", "a-b" and a "/step" suffix, combined in a comma separated list
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := uint(1)
+		if hasStep {
+			parsed, err := strconv.ParseUint(stepPart, 10, 8)
+			if err != nil || parsed == 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = uint(parsed)
+		}
+
+		start, end := bounds.min, bounds.max
+		if rangePart != "*" {
+			startPart, endPart, isRange := strings.Cut(rangePart, "-")
+			parsedStart, err := parseCronValue(startPart, bounds)
+			if err != nil {
+				return 0, err
+			}
+			start, end = parsedStart, parsedStart
+			if isRange {
+				if end, err = parseCronValue(endPart, bounds); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = bounds.max
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, bounds cronField) (uint, error) {
+	maxValue := bounds.max
+	if bounds == cronFields[4] {
+		// sunday can also be written 7
+		maxValue = 7
+	}
+	parsed, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || uint(parsed) < bounds.min || uint(parsed) > maxValue {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return uint(parsed), nil
+}
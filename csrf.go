@@ -0,0 +1,96 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Name of the form field carrying the token (a hidden input in the templates).
+const CsrfFieldName = "csrfToken"
+
+const csrfTokenLifetime = 24 * time.Hour
+
+var ErrInvalidCsrfToken = status.Error(codes.PermissionDenied, "invalid csrf token")
+
+// Secret used to sign and verify the tokens of the actions with RequireCsrf.
+func WithCsrfSecret(secret []byte) Option {
+	return func(o *serverOptions) {
+		o.csrfSecret = secret
+	}
+}
+
+// Check the token of the submitted form (see VerifyCsrfToken) before calling the handler,
+// calls without a valid one are rejected with ErrInvalidCsrfToken (the server must use WithCsrfSecret).
+func RequireCsrf() ActionOption {
+	return func(a *action) {
+		a.csrf = true
+	}
+}
+
+// Create a token bound to the user (0 for an anonymous one), to place in the CsrfFieldName field of the forms,
+// it is valid for 24 hours.
+func NewCsrfToken(userId uint64, secret []byte) string {
+	return makeCsrfToken(userId, secret, time.Now())
+}
+
+// Check the token in the CsrfFieldName field of the submitted form against the user of the call.
+func VerifyCsrfToken(data Data, secret []byte) bool {
+	formData, err := GetFormData(data)
+	if err != nil {
+		return false
+	}
+	token, err := AsString(formData[CsrfFieldName])
+	if err != nil {
+		return false
+	}
+
+	issuedPart, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	issued, err := strconv.ParseInt(issuedPart, 10, 64)
+	if err != nil {
+		return false
+	}
+	issuedAt := time.Unix(issued, 0)
+	if age := time.Since(issuedAt); age < 0 || age > csrfTokenLifetime {
+		return false
+	}
+
+	// an invalid or missing id is handled as anonymous
+	userId, _ := AsUint64(data[UserIdKey])
+	return hmac.Equal([]byte(token), []byte(makeCsrfToken(userId, secret, issuedAt)))
+}
+
+// format : "<unix seconds>.<base64 hmac of user id and unix seconds>"
+func makeCsrfToken(userId uint64, secret []byte, issuedAt time.Time) string {
+	issued := strconv.FormatInt(issuedAt.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatUint(userId, 10) + ":" + issued))
+	return issued + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
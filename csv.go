@@ -0,0 +1,55 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+)
+
+const csvContentType = "text/csv; charset=utf-8"
+
+// CsvHandler write the rows of an export with the csv writer (flushed by the caller).
+type CsvHandler = func(context.Context, Data, *csv.Writer) error
+
+// Register a RAW action serving the rows written by handler as a csv file named filename
+// (the "Content-Type" and "Content-Disposition" headers are set, see SetResponseHeader),
+// the rows are streamed when called with ProcessStreamMethod (see AddStreamAction).
+func (w Widget) AddCsvAction(actionName string, path string, queryNames []string, filename string, handler CsvHandler, opts ...ActionOption) {
+	w.AddStreamAction(actionName, path, queryNames, func(ctx context.Context, data Data, out io.Writer) error {
+		return writeCsv(ctx, data, out, filename, handler)
+	}, opts...)
+}
+
+func writeCsv(ctx context.Context, data Data, out io.Writer, filename string, handler CsvHandler) error {
+	if err := SetResponseHeader(ctx, contentTypeName, csvContentType); err != nil {
+		return err
+	}
+	if err := SetResponseHeader(ctx, contentDispositionName, attachmentDisposition(filename)); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(out)
+	if err := handler(ctx, data, writer); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,88 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+var csvTestRows = [][]string{
+	{"name", "comment"},
+	{"plain", "simple value"},
+	{"with comma", "a, b"},
+	{"with quote", `say "hello"`},
+	{"with newline", "first\nsecond"},
+}
+
+const csvTestBody = "name,comment\nplain,simple value\nwith comma,\"a, b\"\nwith quote,\"say \"\"hello\"\"\"\nwith newline,\"first\nsecond\"\n"
+
+func csvTestHandler(ctx context.Context, data Data, writer *csv.Writer) error {
+	return writer.WriteAll(csvTestRows)
+}
+
+func TestAddCsvAction(t *testing.T) {
+	s := newTestServer(t)
+	s.CreateWidget("test").AddCsvAction("export", "/export", nil, "export.csv", csvTestHandler)
+
+	response, header, err := invoke(context.Background(), s, "test", "export", Data{})
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	if got := string(response.Data); got != csvTestBody {
+		t.Errorf("got body %q, want %q", got, csvTestBody)
+	}
+	if got := header.Get("puzzle-content-type"); len(got) != 1 || got[0] != csvContentType {
+		t.Errorf("got content type %v, want %q", got, csvContentType)
+	}
+	if got := header.Get("puzzle-content-disposition"); len(got) != 1 || got[0] != "attachment; filename=export.csv" {
+		t.Errorf("got content disposition %v", got)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(string(response.Data))).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read the csv : %v", err)
+	}
+	if len(rows) != len(csvTestRows) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(csvTestRows))
+	}
+	for i, row := range rows {
+		if strings.Join(row, "|") != strings.Join(csvTestRows[i], "|") {
+			t.Errorf("row %d : got %q, want %q", i, row, csvTestRows[i])
+		}
+	}
+}
+
+func TestAddCsvActionStream(t *testing.T) {
+	s := newTestServer(t)
+	s.CreateWidget("test").AddCsvAction("export", "/export", nil, "export.csv", csvTestHandler)
+
+	stream, err := invokeStream(context.Background(), s, "test", "export", Data{})
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	if got := string(stream.body()); got != csvTestBody {
+		t.Errorf("got body %q, want %q", got, csvTestBody)
+	}
+	if got := stream.transport.header.Get("puzzle-content-type"); len(got) != 1 || got[0] != csvContentType {
+		t.Errorf("got content type %v, want %q", got, csvContentType)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+// DataHandler return the template data as a map, the encoding is done by the server.
+type DataHandler = func(context.Context, Data) (string, string, Data, error)
+
+// Like AddAction for a templated action whose handler return the data unmarshalled
+// (the server encodes them once with its Codec or the one negotiated with the frontend, see MarshalData).
+func (w Widget) AddDataAction(actionName string, kind pb.MethodKind, path string, handler DataHandler, opts ...ActionOption) {
+	w.AddAction(actionName, kind, path, func(ctx context.Context, data Data) (string, string, []byte, error) {
+		redirect, templateName, resData, err := handler(ctx, data)
+		if err != nil || resData == nil {
+			return redirect, templateName, nil, err
+		}
+
+		encoded, err := MarshalData(ctx, resData)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return redirect, templateName, encoded, nil
+	}, opts...)
+}
+
+func encodeData(data Data) ([]byte, error) {
+	return encodeValue(data)
+}
+
+func encodeValue(value any) ([]byte, error) {
+	buffer := encodeBufferPool.Get().(*bytes.Buffer)
+	defer encodeBufferPool.Put(buffer)
+	buffer.Reset()
+
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	// the buffer is reused, Encode adds a trailing newline
+	encoded := bytes.TrimSuffix(buffer.Bytes(), []byte{'\n'})
+	return append([]byte(nil), encoded...), nil
+}
@@ -0,0 +1,320 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Result of an handler kept to answer a duplicated submission.
+type SubmissionResult struct {
+	Redirect     string
+	TemplateName string
+	Data         []byte
+	// header metadata set by the handler (like the Content-Type, the data encoding or the flash messages)
+	Header metadata.MD
+	// flash messages (see AddFlash) and session updates queued in data, sent after the handler
+	Flashes        []Flash
+	SessionUpdates Data
+	CacheControl   string
+}
+
+// SubmissionStore keep the results of the actions marked with Deduplicated.
+type SubmissionStore interface {
+	Load(key string) (SubmissionResult, bool)
+	Store(key string, result SubmissionResult, ttl time.Duration)
+}
+
+// minimal delay between two removals of the expired entries of the memory store
+const memorySweepInterval = time.Minute
+
+type memoryEntry struct {
+	result  SubmissionResult
+	expires time.Time
+}
+
+type memorySubmissionStore struct {
+	mutex     sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+// In memory SubmissionStore (the default one), not shared between server instances.
+func NewMemorySubmissionStore() SubmissionStore {
+	return &memorySubmissionStore{entries: map[string]memoryEntry{}, lastSweep: time.Now()}
+}
+
+func (m *memorySubmissionStore) Load(key string) (SubmissionResult, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return SubmissionResult{}, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(m.entries, key)
+		return SubmissionResult{}, false
+	}
+	return entry.result, true
+}
+
+func (m *memorySubmissionStore) Store(key string, result SubmissionResult, ttl time.Duration) {
+	now := time.Now()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// entries never loaded again are removed at most once per interval
+	if now.Sub(m.lastSweep) > memorySweepInterval {
+		m.lastSweep = now
+		for entryKey, entry := range m.entries {
+			if now.After(entry.expires) {
+				delete(m.entries, entryKey)
+			}
+		}
+	}
+	m.entries[key] = memoryEntry{result: result, expires: now.Add(ttl)}
+}
+
+// handler call in progress for a submission key
+type submissionCall struct {
+	done   chan struct{}
+	result SubmissionResult
+	err    error
+}
+
+// identical submissions arriving while the first one is handled wait for its result
+type submissionGroup struct {
+	mutex sync.Mutex
+	calls map[string]*submissionCall
+}
+
+func newSubmissionGroup() *submissionGroup {
+	return &submissionGroup{calls: map[string]*submissionCall{}}
+}
+
+// return the call in progress for key, or register a new one (with true, the caller must run the handler and leave)
+func (g *submissionGroup) join(key string) (*submissionCall, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if call, ok := g.calls[key]; ok {
+		return call, false
+	}
+	call := &submissionCall{done: make(chan struct{})}
+	g.calls[key] = call
+	return call, true
+}
+
+func (g *submissionGroup) leave(key string, call *submissionCall) {
+	g.mutex.Lock()
+	delete(g.calls, key)
+	g.mutex.Unlock()
+
+	close(call.done)
+}
+
+// Use store for the actions marked with Deduplicated (default to NewMemorySubmissionStore()).
+func WithSubmissionStore(store SubmissionStore) Option {
+	return func(o *serverOptions) {
+		o.submissions = store
+	}
+}
+
+// When the same connected user submit identical form data (with the same path and query parameters)
+// to this action during ttl, the previous result (with the headers, flash messages and session updates
+// of the first call) is returned instead of calling the handler again, a submission arriving while
+// the first one is handled by the same server instance waits for its result.
+// Anonymous calls and streamed calls (see AddStreamAction) are never deduplicated.
+func Deduplicated(ttl time.Duration) ActionOption {
+	return func(a *action) {
+		a.dedupTTL = ttl
+	}
+}
+
+func deduplicate(store SubmissionStore, group *submissionGroup, widgetName string, actionName string, ttl time.Duration, handler ActionHandler) ActionHandler {
+	return func(ctx context.Context, data Data) (string, string, []byte, error) {
+		userId, err := GetCurrentUserId(data)
+		if err != nil {
+			// without user, different callers could not be told apart
+			return handler(ctx, data)
+		}
+
+		encodingName := ""
+		if encoding, ok := ctx.Value(dataEncodingContextKey).(*dataEncoding); ok {
+			encodingName = encoding.name
+		}
+		key, err := submissionKey(widgetName, actionName, userId, encodingName, data)
+		if err != nil {
+			return "", "", nil, err
+		}
+
+		for {
+			if result, ok := store.Load(key); ok {
+				return replaySubmission(ctx, data, result)
+			}
+
+			call, first := group.join(key)
+			if first {
+				return handleSubmission(ctx, store, group, key, call, ttl, handler, data)
+			}
+
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return "", "", nil, ctx.Err()
+			}
+			if call.err == nil {
+				return replaySubmission(ctx, data, call.result)
+			}
+			if !errors.Is(call.err, context.Canceled) && !errors.Is(call.err, context.DeadlineExceeded) {
+				return "", "", nil, call.err
+			}
+			// the first caller gave up (like a browser aborting the first submission), try again
+		}
+	}
+}
+
+func handleSubmission(ctx context.Context, store SubmissionStore, group *submissionGroup, key string, call *submissionCall, ttl time.Duration, handler ActionHandler, data Data) (string, string, []byte, error) {
+	// kept when the handler panics
+	call.err = errRecoveredPanic
+	defer group.leave(key, call)
+
+	// a call with the same key could have ended between the Load and the join
+	if result, ok := store.Load(key); ok {
+		call.result, call.err = result, nil
+		return replaySubmission(ctx, data, result)
+	}
+
+	ctx, recorder := recordHeader(ctx)
+	redirect, templateName, resData, err := handler(ctx, data)
+	call.err = err
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	result := SubmissionResult{Redirect: redirect, TemplateName: templateName, Data: resData, Header: recorder.get()}
+	if pending, _ := data[pendingFlashesKey].([]Flash); len(pending) != 0 {
+		result.Flashes = append([]Flash(nil), pending...)
+	}
+	if updates, _ := data[sessionUpdatesKey].(Data); len(updates) != 0 {
+		result.SessionUpdates = CloneData(updates)
+	}
+	if directive, ok := ctx.Value(cacheContextKey).(*cacheDirective); ok {
+		result.CacheControl = directive.get()
+	}
+	call.result = result
+	store.Store(key, result, ttl)
+	return redirect, templateName, resData, nil
+}
+
+// send again what the first call sent beside its return values
+func replaySubmission(ctx context.Context, data Data, result SubmissionResult) (string, string, []byte, error) {
+	if len(result.Header) != 0 {
+		if err := grpc.SetHeader(ctx, result.Header.Copy()); err != nil {
+			return "", "", nil, err
+		}
+		encodingHeader := headerPrefix + strings.ToLower(dataEncodingName)
+		if encoding, ok := ctx.Value(dataEncodingContextKey).(*dataEncoding); ok && len(result.Header.Get(encodingHeader)) != 0 {
+			// the replayed data are not json
+			encoding.used = true
+		}
+	}
+	if len(result.Flashes) != 0 {
+		data[pendingFlashesKey] = append([]Flash(nil), result.Flashes...)
+	}
+	if len(result.SessionUpdates) != 0 {
+		data[sessionUpdatesKey] = CloneData(result.SessionUpdates)
+	}
+	if result.CacheControl != "" {
+		if directive, ok := ctx.Value(cacheContextKey).(*cacheDirective); ok {
+			directive.set(result.CacheControl)
+		}
+	}
+	return result.Redirect, result.TemplateName, result.Data, nil
+}
+
+// forward the header metadata to the stream of the call and keep a copy
+type headerRecorder struct {
+	grpc.ServerTransportStream
+	mutex  sync.Mutex
+	header metadata.MD
+}
+
+func recordHeader(ctx context.Context) (context.Context, *headerRecorder) {
+	recorder := &headerRecorder{}
+	if stream := grpc.ServerTransportStreamFromContext(ctx); stream != nil {
+		recorder.ServerTransportStream = stream
+		ctx = grpc.NewContextWithServerTransportStream(ctx, recorder)
+	}
+	return ctx, recorder
+}
+
+func (r *headerRecorder) SetHeader(md metadata.MD) error {
+	if err := r.ServerTransportStream.SetHeader(md); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	r.header = metadata.Join(r.header, md)
+	r.mutex.Unlock()
+	return nil
+}
+
+func (r *headerRecorder) get() metadata.MD {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.header
+}
+
+// hash of the canonicalized submission (json.Marshal sort map keys) with the submitter identity,
+// the submission is the form data with the path and query parameters
+func submissionKey(widgetName string, actionName string, userId uint64, encodingName string, data Data) (string, error) {
+	submitted := Data{FormKey: data[FormKey]}
+	for key, value := range data {
+		if strings.HasPrefix(key, PathDataPrefix) || strings.HasPrefix(key, QueryDataPrefix) {
+			submitted[key] = value
+		}
+	}
+	submittedBytes, err := json.Marshal(submitted)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{widgetName, actionName, strconv.FormatUint(userId, 10), encodingName} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(submittedBytes)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
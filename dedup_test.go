@@ -0,0 +1,242 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestDeduplicate(t *testing.T) {
+	tests := []struct {
+		name      string
+		first     Data
+		second    Data
+		wantCalls int
+	}{
+		{
+			name:      "genuine duplicate",
+			first:     Data{UserIdKey: 1, FormKey: Data{"title": "hello"}},
+			second:    Data{UserIdKey: 1, FormKey: Data{"title": "hello"}},
+			wantCalls: 1,
+		},
+		{
+			name:      "distinct form",
+			first:     Data{UserIdKey: 1, FormKey: Data{"title": "hello"}},
+			second:    Data{UserIdKey: 1, FormKey: Data{"title": "world"}},
+			wantCalls: 2,
+		},
+		{
+			name:      "distinct path parameter",
+			first:     Data{UserIdKey: 1, PathDataPrefix + "id": "5"},
+			second:    Data{UserIdKey: 1, PathDataPrefix + "id": "6"},
+			wantCalls: 2,
+		},
+		{
+			name:      "distinct query parameter",
+			first:     Data{UserIdKey: 1, QueryDataPrefix + "page": "1"},
+			second:    Data{UserIdKey: 1, QueryDataPrefix + "page": "2"},
+			wantCalls: 2,
+		},
+		{
+			name:      "distinct users",
+			first:     Data{UserIdKey: 1, FormKey: Data{"title": "hello"}},
+			second:    Data{UserIdKey: 2, FormKey: Data{"title": "hello"}},
+			wantCalls: 2,
+		},
+		{
+			name:      "anonymous",
+			first:     Data{FormKey: Data{"title": "hello"}},
+			second:    Data{FormKey: Data{"title": "hello"}},
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := deduplicate(NewMemorySubmissionStore(), newSubmissionGroup(), "widget", "action", time.Minute, func(ctx context.Context, data Data) (string, string, []byte, error) {
+				calls++
+				return "", "template", []byte{byte(calls)}, nil
+			})
+
+			_, _, firstData, err := handler(context.Background(), tt.first)
+			if err != nil {
+				t.Fatalf("unexpected error on first call : %v", err)
+			}
+			_, templateName, secondData, err := handler(context.Background(), tt.second)
+			if err != nil {
+				t.Fatalf("unexpected error on second call : %v", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", calls, tt.wantCalls)
+			}
+			if templateName != "template" {
+				t.Errorf("got templateName %q, want %q", templateName, "template")
+			}
+			if replayed := secondData[0] == firstData[0]; replayed != (tt.wantCalls == 1) {
+				t.Errorf("second result replayed : %v", replayed)
+			}
+		})
+	}
+}
+
+func TestDeduplicateExpiration(t *testing.T) {
+	calls := 0
+	handler := deduplicate(NewMemorySubmissionStore(), newSubmissionGroup(), "widget", "action", time.Millisecond, func(ctx context.Context, data Data) (string, string, []byte, error) {
+		calls++
+		return "", "", nil, nil
+	})
+
+	data := Data{UserIdKey: 1, FormKey: Data{"title": "hello"}}
+	handler(context.Background(), data)
+	time.Sleep(5 * time.Millisecond)
+	handler(context.Background(), data)
+	if calls != 2 {
+		t.Errorf("handler called %d times after expiration, want 2", calls)
+	}
+}
+
+func TestDeduplicateConcurrent(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := deduplicate(NewMemorySubmissionStore(), newSubmissionGroup(), "widget", "action", time.Minute, func(ctx context.Context, data Data) (string, string, []byte, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return "/done", "", nil, nil
+	})
+
+	const callers = 10
+	redirects := make(chan string, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			redirect, _, _, err := handler(context.Background(), Data{UserIdKey: 1, FormKey: Data{"title": "hello"}})
+			if err != nil {
+				redirect = err.Error()
+			}
+			redirects <- redirect
+		}()
+	}
+	<-started
+	// let the other callers reach the wait
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < callers; i++ {
+		if redirect := <-redirects; redirect != "/done" {
+			t.Errorf("got redirect %q, want %q", redirect, "/done")
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("handler called %d times, want 1", got)
+	}
+}
+
+func TestDeduplicateCanceledFirstCall(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	handler := deduplicate(NewMemorySubmissionStore(), newSubmissionGroup(), "widget", "action", time.Minute, func(ctx context.Context, data Data) (string, string, []byte, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-ctx.Done()
+			return "", "", nil, ctx.Err()
+		}
+		return "/done", "", nil, nil
+	})
+
+	data := Data{UserIdKey: 1, FormKey: Data{"title": "hello"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, _, _, err := handler(ctx, data)
+		firstErr <- err
+	}()
+	<-started
+
+	secondRedirect := make(chan string, 1)
+	go func() {
+		redirect, _, _, _ := handler(context.Background(), CloneData(data))
+		secondRedirect <- redirect
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("got error %v on the canceled call, want %v", err, context.Canceled)
+	}
+	if redirect := <-secondRedirect; redirect != "/done" {
+		t.Errorf("got redirect %q after the first call gave up, want %q", redirect, "/done")
+	}
+}
+
+func TestDeduplicateReplayHeaders(t *testing.T) {
+	s := newTestServer(t, WithDataEncoding("msgpack", MsgpackCodec{}))
+	calls := 0
+	s.CreateWidget("test").AddAction("save", pb.MethodKind_POST, "/save", func(ctx context.Context, data Data) (string, string, []byte, error) {
+		calls++
+		if err := SetResponseHeader(ctx, "Content-Type", "text/plain"); err != nil {
+			return "", "", nil, err
+		}
+		if err := SetFlash(ctx, "info", "first"); err != nil {
+			return "", "", nil, err
+		}
+		AddFlash(data, "info", "second")
+		if err := SetSession(data, "last", "hello"); err != nil {
+			return "", "", nil, err
+		}
+		SetCacheControl(ctx, time.Minute, true)
+		resData, err := MarshalData(ctx, Data{"saved": true})
+		return "", "view", resData, err
+	}, Deduplicated(time.Minute))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(acceptDataHeader, "msgpack"))
+	data := Data{UserIdKey: 1, FormKey: Data{"title": "hello"}}
+	firstResponse, firstHeader, err := invoke(ctx, s, "test", "save", data)
+	if err != nil {
+		t.Fatalf("unexpected error on first call : %v", err)
+	}
+	secondResponse, secondHeader, err := invoke(ctx, s, "test", "save", data)
+	if err != nil {
+		t.Fatalf("unexpected error on second call : %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	if !bytes.Equal(secondResponse.Data, firstResponse.Data) {
+		t.Errorf("got data %q, want %q", secondResponse.Data, firstResponse.Data)
+	}
+	for _, name := range []string{"puzzle-content-type", "puzzle-data-encoding", flashHeader, sessionHeader, "puzzle-cache-control"} {
+		if got, want := secondHeader.Get(name), firstHeader.Get(name); len(want) == 0 || !reflect.DeepEqual(got, want) {
+			t.Errorf("got header %s %v, want %v", name, got, want)
+		}
+	}
+	if got := secondHeader.Get(flashHeader); len(got) != 2 {
+		t.Errorf("got flashes %v, want 2", got)
+	}
+}
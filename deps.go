@@ -0,0 +1,92 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var ErrMissingDependency = errors.New("no dependency provided for type")
+
+// Deps hold the shared dependencies of the handlers (database clients, service stubs, etc.)
+// indexed by type, see Provide and Resolve.
+type Deps struct {
+	inner *depsInner
+}
+
+type depsInner struct {
+	lock   sync.RWMutex
+	values map[reflect.Type]any
+}
+
+func newDeps() Deps {
+	return Deps{inner: &depsInner{values: map[reflect.Type]any{}}}
+}
+
+// Register value as the dependency of type T (replacing the previous one),
+// use an interface or a pointer type to share a single instance.
+func Provide[T any](deps Deps, value T) {
+	deps.inner.lock.Lock()
+	defer deps.inner.lock.Unlock()
+
+	deps.inner.values[typeOf[T]()] = value
+}
+
+// Return the dependency of type T, or an error wrapping ErrMissingDependency when none was provided.
+func Resolve[T any](deps Deps) (T, error) {
+	deps.inner.lock.RLock()
+	value, ok := deps.inner.values[typeOf[T]()]
+	deps.inner.lock.RUnlock()
+
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%w : %s", ErrMissingDependency, typeOf[T]())
+	}
+	return value.(T), nil
+}
+
+// Like Resolve but panic when the dependency is missing, intended for the wiring at startup.
+func MustResolve[T any](deps Deps) T {
+	value, err := Resolve[T](deps)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// work with interface types (reflect.TypeOf of a nil interface value is nil)
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Return the dependencies shared by the widgets of the server.
+func (s WidgetServer) Deps() Deps {
+	return s.deps
+}
+
+// Like CreateWidget but the widget is configured by setup with the dependencies of the server,
+// so handlers can be built from them instead of package level variables.
+func (s WidgetServer) CreateWidgetWith(widgetName string, setup func(Deps, Widget)) Widget {
+	widget := s.CreateWidget(widgetName)
+	setup(s.deps, widget)
+	return widget
+}
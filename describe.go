@@ -0,0 +1,58 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"encoding/json"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+// binary header (descriptions could contain any character)
+const descriptionHeader = headerPrefix + "description-bin"
+
+type actionDescription struct {
+	Description    string   `json:"description,omitempty"`
+	RequiredParams []string `json:"requiredParams,omitempty"`
+}
+
+type widgetDescription struct {
+	Description string                       `json:"description,omitempty"`
+	Actions     map[string]actionDescription `json:"actions,omitempty"`
+}
+
+// return nil when there is nothing to describe (the header is then not sent),
+// should be called with the lock held
+func describeWidget(widget Widget, actions []*pb.Action) ([]byte, error) {
+	described := widgetDescription{Description: widget.description}
+	for _, pbAction := range actions {
+		a := widget.actions[pbAction.Name]
+		if a.description == "" && len(a.required) == 0 {
+			continue
+		}
+		if described.Actions == nil {
+			described.Actions = map[string]actionDescription{}
+		}
+		described.Actions[pbAction.Name] = actionDescription{Description: a.description, RequiredParams: a.required}
+	}
+	if described.Description == "" && len(described.Actions) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(described)
+}
@@ -0,0 +1,91 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import "reflect"
+
+// Return the submitted entries whose value differs from the current one (absent from current included).
+// The comparison is done in the type of the current value (so "5" and 5 are equal) and an error is
+// returned when a submitted value can not be converted to it, nil and "" are considered equal.
+func DiffForm(submitted Data, current Data) (Data, error) {
+	changed := Data{}
+	for key, value := range submitted {
+		currentValue, ok := current[key]
+		if !ok {
+			changed[key] = value
+			continue
+		}
+		same, err := sameValue(value, currentValue)
+		if err != nil {
+			return nil, FieldError{Field: key, Message: err.Error()}
+		}
+		if !same {
+			changed[key] = value
+		}
+	}
+	return changed, nil
+}
+
+func sameValue(submitted any, current any) (bool, error) {
+	if isEmptyValue(submitted) || isEmptyValue(current) {
+		return isEmptyValue(submitted) && isEmptyValue(current), nil
+	}
+
+	switch casted := current.(type) {
+	case bool:
+		b, err := AsBool(submitted)
+		return b == casted, err
+	case string:
+		switch submitted.(type) {
+		case string:
+			return submitted == casted, nil
+		case bool:
+			b, err := AsBool(casted)
+			return err == nil && b == submitted, nil
+		}
+		if _, err := AsFloat64(submitted); err == nil {
+			same, err := sameNumber(submitted, casted)
+			return err == nil && same, nil
+		}
+	case uint, uint8, uint16, uint32, uint64, int, int8, int16, int32, int64, float32, float64:
+		return sameNumber(submitted, casted)
+	}
+	return reflect.DeepEqual(submitted, current), nil
+}
+
+// integral values are compared as integers (a float64 loses precision above 2^53)
+func sameNumber(submitted any, current any) (bool, error) {
+	if i, err := AsInt64(submitted); err == nil {
+		if currentInt, err := AsInt64(current); err == nil {
+			return i == currentInt, nil
+		}
+	}
+	if u, err := AsUint64(submitted); err == nil {
+		if currentUint, err := AsUint64(current); err == nil {
+			return u == currentUint, nil
+		}
+	}
+	currentFloat, _ := AsFloat64(current)
+	f, err := AsFloat64(submitted)
+	return f == currentFloat, err
+}
+
+func isEmptyValue(value any) bool {
+	return value == nil || value == ""
+}
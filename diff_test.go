@@ -0,0 +1,77 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffForm(t *testing.T) {
+	tests := []struct {
+		name      string
+		submitted any
+		current   any
+		wantSame  bool
+		wantErr   bool
+	}{
+		{name: "string and int", submitted: "5", current: 5, wantSame: true},
+		{name: "int and string", submitted: 5, current: "5", wantSame: true},
+		{name: "different string and int", submitted: "6", current: 5},
+		{name: "float string and int", submitted: "5.0", current: 5, wantSame: true},
+		{name: "fractional and int", submitted: 5.5, current: 5},
+		{name: "float and int64", submitted: float64(7), current: int64(7), wantSame: true},
+		{name: "large integers", submitted: int64(9007199254740993), current: int64(9007199254740992)},
+		{name: "large integer strings", submitted: "9007199254740993", current: int64(9007199254740992)},
+		{name: "large unsigned", submitted: "18446744073709551615", current: uint64(18446744073709551614)},
+		{name: "negative and unsigned", submitted: -1, current: uint64(18446744073709551615)},
+		{name: "not a number", submitted: "abc", current: 5, wantErr: true},
+		{name: "string and bool", submitted: "true", current: true, wantSame: true},
+		{name: "nil and empty", submitted: nil, current: "", wantSame: true},
+		{name: "empty and value", submitted: "", current: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, err := DiffForm(Data{"field": tt.submitted}, Data{"field": tt.current})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			want := Data{"field": tt.submitted}
+			if tt.wantSame {
+				want = Data{}
+			}
+			if !reflect.DeepEqual(changed, want) {
+				t.Errorf("got %v, want %v", changed, want)
+			}
+		})
+	}
+}
+
+func TestDiffFormAbsent(t *testing.T) {
+	changed, err := DiffForm(Data{"name": "a", "added": "b"}, Data{"name": "a"})
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	if want := (Data{"added": "b"}); !reflect.DeepEqual(changed, want) {
+		t.Errorf("got %v, want %v", changed, want)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// metadata sent by the frontend with the names of the encodings it can decode, by preference order
+const acceptDataHeader = headerPrefix + "accept-data"
+
+// sent as "puzzle-data-encoding"
+const dataEncodingName = "Data-Encoding"
+
+type namedCodec struct {
+	name  string
+	codec Codec
+}
+
+// codec chosen for the response of a call
+type dataEncoding struct {
+	namedCodec
+	used bool
+}
+
+// Register an alternative encoding of the template data (like "msgpack" with MsgpackCodec),
+// used by MarshalData (and AddDataAction) when the frontend lists name in the "puzzle-accept-data"
+// metadata of the call (comma separated, by preference order). The chosen encoding is sent
+// in the "puzzle-data-encoding" header metadata, its absence means json.
+func WithDataEncoding(name string, codec Codec) Option {
+	return func(o *serverOptions) {
+		o.dataEncodings = append(o.dataEncodings, namedCodec{name: name, codec: codec})
+	}
+}
+
+// Encode the template data with the encoding negotiated with the frontend (see WithDataEncoding),
+// or with the Codec of the server (see WithCodec, also used in the async jobs and scheduled tasks).
+// StdCodec is used with a context which does not come from the server.
+func MarshalData(ctx context.Context, value any) ([]byte, error) {
+	encoding, ok := ctx.Value(dataEncodingContextKey).(*dataEncoding)
+	if !ok {
+		return StdCodec{}.Marshal(value)
+	}
+
+	encoded, err := encoding.codec.Marshal(value)
+	if err != nil || encoding.name == "" {
+		return encoded, err
+	}
+	if !encoding.used {
+		encoding.used = true
+		if err = SetResponseHeader(ctx, dataEncodingName, encoding.name); err != nil {
+			return nil, err
+		}
+	}
+	return encoded, nil
+}
+
+func contextWithDataEncoding(ctx context.Context, defaultCodec Codec, encodings []namedCodec) (context.Context, *dataEncoding) {
+	encoding := &dataEncoding{namedCodec: namedCodec{codec: defaultCodec}}
+	if len(encodings) != 0 {
+		if chosen, ok := negotiateEncoding(ctx, encodings); ok {
+			encoding.namedCodec = chosen
+		}
+	}
+	return context.WithValue(ctx, dataEncodingContextKey, encoding), encoding
+}
+
+// without negotiation, for the contexts of the server outside of the calls
+func contextWithCodec(ctx context.Context, codec Codec) context.Context {
+	return context.WithValue(ctx, dataEncodingContextKey, &dataEncoding{namedCodec: namedCodec{codec: codec}})
+}
+
+func negotiateEncoding(ctx context.Context, encodings []namedCodec) (namedCodec, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get(acceptDataHeader) {
+		for _, accepted := range strings.Split(value, ",") {
+			accepted = strings.TrimSpace(accepted)
+			for _, encoding := range encodings {
+				if encoding.name == accepted {
+					return encoding, true
+				}
+			}
+		}
+	}
+	return namedCodec{}, false
+}
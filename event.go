@@ -0,0 +1,113 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"go.uber.org/zap"
+)
+
+// Domain event published after a successful action,
+// the WidgetName, ActionName, UserId and Time are filled by Process when empty.
+type Event struct {
+	Name       string
+	WidgetName string
+	ActionName string
+	UserId     uint64
+	Payload    any
+	Time       time.Time
+}
+
+// EventPublisher bridge the server to an event bus.
+type EventPublisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+type eventCollector struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+// Publish the events of successful actions with publisher : the ones emitted by the handler with EmitEvent,
+// or, when there is none and the action is a mutating one (POST, PUT, PATCH or DELETE), a default event
+// named "widgetName.actionName". Nothing is published when the handler fails.
+func WithEventPublisher(publisher EventPublisher) Option {
+	return func(o *serverOptions) {
+		o.events = publisher
+	}
+}
+
+// Queue an event to publish if the current action succeed (no-op without EventPublisher).
+func EmitEvent(ctx context.Context, event Event) {
+	if collector, ok := ctx.Value(eventContextKey).(*eventCollector); ok {
+		collector.mutex.Lock()
+		collector.events = append(collector.events, event)
+		collector.mutex.Unlock()
+	}
+}
+
+func contextWithEventCollector(ctx context.Context) (context.Context, *eventCollector) {
+	collector := &eventCollector{}
+	return context.WithValue(ctx, eventContextKey, collector), collector
+}
+
+func (s widgetServerAdapter) publishEvents(ctx context.Context, collector *eventCollector, kind pb.MethodKind, widgetName string, actionName string, data Data) {
+	collector.mutex.Lock()
+	events := collector.events
+	collector.mutex.Unlock()
+
+	if len(events) == 0 {
+		if !isMutating(kind) {
+			return
+		}
+		events = []Event{{Name: widgetName + "." + actionName}}
+	}
+
+	userId, _ := GetCurrentUserId(data)
+	now := time.Now()
+	for _, event := range events {
+		if event.WidgetName == "" {
+			event.WidgetName = widgetName
+		}
+		if event.ActionName == "" {
+			event.ActionName = actionName
+		}
+		if event.UserId == 0 {
+			event.UserId = userId
+		}
+		if event.Time.IsZero() {
+			event.Time = now
+		}
+		if err := s.options.events.Publish(ctx, event); err != nil {
+			s.logger.WarnContext(ctx, "Failed to publish event", zap.String("event", event.Name), zap.Error(err))
+		}
+	}
+}
+
+func isMutating(kind pb.MethodKind) bool {
+	switch kind {
+	case pb.MethodKind_POST, pb.MethodKind_PUT, pb.MethodKind_PATCH, pb.MethodKind_DELETE:
+		return true
+	}
+	return false
+}
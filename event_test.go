@@ -0,0 +1,86 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+type stubPublisher struct {
+	mutex  sync.Mutex
+	events []Event
+}
+
+func (p *stubPublisher) Publish(ctx context.Context, event Event) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+func emittingHandler(ctx context.Context, data Data) (string, string, []byte, error) {
+	EmitEvent(ctx, Event{Name: "user.updated", Payload: "payload"})
+	return "", "", nil, nil
+}
+
+func emittingFailingHandler(ctx context.Context, data Data) (string, string, []byte, error) {
+	EmitEvent(ctx, Event{Name: "user.updated"})
+	return "", "", nil, errInternalTest
+}
+
+func TestEventPublisher(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      pb.MethodKind
+		handler   ActionHandler
+		wantNames []string
+	}{
+		{name: "emitted on success", kind: pb.MethodKind_POST, handler: emittingHandler, wantNames: []string{"user.updated"}},
+		{name: "default on mutating success", kind: pb.MethodKind_PUT, handler: noopHandler, wantNames: []string{"test.action"}},
+		{name: "none on reading success", kind: pb.MethodKind_GET, handler: noopHandler},
+		{name: "none on error", kind: pb.MethodKind_POST, handler: failingHandler},
+		{name: "none on error after emit", kind: pb.MethodKind_POST, handler: emittingFailingHandler},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &stubPublisher{}
+			s := newTestServer(t, WithEventPublisher(publisher))
+			s.CreateWidget("test").AddAction("action", tt.kind, "/action", tt.handler)
+
+			invoke(context.Background(), s, "test", "action", Data{UserIdKey: 7})
+
+			if len(publisher.events) != len(tt.wantNames) {
+				t.Fatalf("got %d events, want %d", len(publisher.events), len(tt.wantNames))
+			}
+			for i, event := range publisher.events {
+				if event.Name != tt.wantNames[i] {
+					t.Errorf("got event %q, want %q", event.Name, tt.wantNames[i])
+				}
+				if event.WidgetName != "test" || event.ActionName != "action" || event.UserId != 7 || event.Time.IsZero() {
+					t.Errorf("event not filled : %+v", event)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// number of bytes considered by http.DetectContentType
+const sniffLen = 512
+
+// Returned to the frontend when a file content does not match the accepted types.
+var ErrFileType = status.Error(codes.InvalidArgument, "file type not allowed")
+
+// Check the type of content, sniffed with http.DetectContentType (the name and the type declared
+// by the browser are not trusted), against allowed media types (like "image/png" or "image/*").
+func ValidateFileType(content []byte, allowed []string) error {
+	if len(content) > sniffLen {
+		content = content[:sniffLen]
+	}
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(content))
+	if err != nil {
+		return ErrFileType
+	}
+	for _, allowedType := range allowed {
+		if allowedType == mediaType {
+			return nil
+		}
+		if prefix, ok := strings.CutSuffix(allowedType, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return nil
+		}
+	}
+	return ErrFileType
+}
+
+// Reject with ErrFileType the calls of the action with a file whose content does not match one of
+// the allowed media types (see ValidateFileType).
+func AllowedFileTypes(allowed ...string) ActionOption {
+	return func(a *action) {
+		a.fileTypes = append(a.fileTypes, allowed...)
+	}
+}
+
+func checkFileTypes(files map[string][]byte, parts map[string]FilePart, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, content := range files {
+		if err := ValidateFileType(content, allowed); err != nil {
+			return err
+		}
+	}
+	for _, part := range parts {
+		head, err := part.head()
+		if err != nil {
+			return err
+		}
+		if err = ValidateFileType(head, allowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p FilePart) head() ([]byte, error) {
+	reader, err := p.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	buffer := make([]byte, sniffLen)
+	n, err := io.ReadFull(reader, buffer)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buffer[:n], err
+}
@@ -0,0 +1,111 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const filterPrefix = "filter/"
+
+// Values of the filter fields of a search (see GetFilters), blank values are not kept.
+type Filters struct {
+	values map[string]string
+}
+
+// Return the query names of the allowed filter fields ("filter/author" for "author"),
+// to declare with AddActionWithQuery.
+func GetFilterNames(allowedFields []string) []string {
+	names := make([]string, 0, len(allowedFields))
+	for _, field := range allowedFields {
+		names = append(names, filterPrefix+field)
+	}
+	return names
+}
+
+// Read the "filter/field" query parameters of the allowedFields (like "filter/author" or "filter/dateFrom").
+func GetFilters(data Data, allowedFields []string) Filters {
+	values := map[string]string{}
+	for _, field := range allowedFields {
+		value, _ := GetQueryString(data, filterPrefix+field)
+		if value = strings.TrimSpace(value); value != "" {
+			values[field] = value
+		}
+	}
+	return Filters{values: values}
+}
+
+// Place the filters in data (a "Filters" map from field to value) for the template, to fill the search form again.
+func InitFilters(data Data, filters Filters) {
+	values := make(map[string]string, len(filters.values))
+	for field, value := range filters.values {
+		values[field] = value
+	}
+	data["Filters"] = values
+}
+
+func (f Filters) Has(field string) bool {
+	_, ok := f.values[field]
+	return ok
+}
+
+// Return the filtered fields sorted by name.
+func (f Filters) Fields() []string {
+	fields := make([]string, 0, len(f.values))
+	for field := range f.values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (f Filters) String(field string) string {
+	return f.values[field]
+}
+
+// The zero time is returned when the field is absent (see AsTime for the accepted formats).
+func (f Filters) Time(field string) (time.Time, error) {
+	return AsTime(f.optional(field))
+}
+
+func (f Filters) Uint64(field string) (uint64, error) {
+	return AsUint64(f.optional(field))
+}
+
+func (f Filters) Int64(field string) (int64, error) {
+	return AsInt64(f.optional(field))
+}
+
+func (f Filters) Float64(field string) (float64, error) {
+	return AsFloat64(f.optional(field))
+}
+
+func (f Filters) Bool(field string) (bool, error) {
+	return AsBool(f.optional(field))
+}
+
+// nil for an absent field, so the As* helpers return their zero value
+func (f Filters) optional(field string) any {
+	if value, ok := f.values[field]; ok {
+		return value
+	}
+	return nil
+}
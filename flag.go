@@ -0,0 +1,66 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import "context"
+
+// Bridge to an external feature flag system,
+// data is nil when the evaluation is done for GetWidget (no call data available).
+type FlagEvaluator interface {
+	Enabled(ctx context.Context, flagName string, data Data) bool
+}
+
+// Use evaluator to decide if the actions declared with GuardedByFlag are enabled
+// (without evaluator, all actions are enabled).
+func WithFlagEvaluator(evaluator FlagEvaluator) Option {
+	return func(o *serverOptions) {
+		o.flags = evaluator
+	}
+}
+
+// The action is only available when the flag is enabled, otherwise it is omitted
+// from GetWidget and Process answers as if the action did not exist.
+func GuardedByFlag(flagName string) ActionOption {
+	return func(a *action) {
+		a.flag = flagName
+	}
+}
+
+func (s widgetServerAdapter) isEnabled(ctx context.Context, a action, data Data) bool {
+	return isEnabled(ctx, s.options.flags, a, data)
+}
+
+func isEnabled(ctx context.Context, flags FlagEvaluator, a action, data Data) bool {
+	return a.flag == "" || flags == nil || flags.Enabled(ctx, a.flag, data)
+}
+
+// Check that the action exists and is currently enabled (data can be nil), without calling its handler.
+//
+// Remote frontends get the same information with GetWidget, which omits disabled actions.
+func (s WidgetServer) HasAction(ctx context.Context, widgetName string, actionName string, data Data) bool {
+	s.registry.lock.RLock()
+	widget, ok := s.registry.widgets[widgetName]
+	var a action
+	if ok {
+		a, ok = widget.actions[actionName]
+	}
+	s.registry.lock.RUnlock()
+
+	return ok && isEnabled(ctx, s.options.flags, a, data)
+}
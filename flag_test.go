@@ -0,0 +1,124 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type stubFlags map[string]bool
+
+func (f stubFlags) Enabled(ctx context.Context, flagName string, data Data) bool {
+	return f[flagName]
+}
+
+func TestGuardedByFlag(t *testing.T) {
+	flags := stubFlags{}
+	tests := []struct {
+		name        string
+		options     []Option
+		enabled     bool
+		wantVisible bool
+	}{
+		{name: "flag on", options: []Option{WithFlagEvaluator(flags)}, enabled: true, wantVisible: true},
+		{name: "flag off", options: []Option{WithFlagEvaluator(flags)}, enabled: false, wantVisible: false},
+		{name: "without evaluator", enabled: false, wantVisible: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags["beta"] = tt.enabled
+			s := newTestServer(t, tt.options...)
+			widget := s.CreateWidget("widget")
+			widget.AddAction("stable", pb.MethodKind_GET, "/stable", noopHandler)
+			widget.AddAction("guarded", pb.MethodKind_GET, "/guarded", noopHandler, GuardedByFlag("beta"))
+
+			response, err := s.Handler().GetWidget(context.Background(), &pb.WidgetRequest{Name: "widget"})
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			visible := false
+			for _, a := range response.Actions {
+				visible = visible || a.Name == "guarded"
+			}
+			if visible != tt.wantVisible {
+				t.Errorf("guarded action listed by GetWidget : %v, want %v", visible, tt.wantVisible)
+			}
+
+			wantCode := codes.OK
+			if !tt.wantVisible {
+				wantCode = codes.NotFound
+			}
+			if _, _, err = invoke(context.Background(), s, "widget", "guarded", Data{}); status.Code(err) != wantCode {
+				t.Errorf("got code %v, want %v", status.Code(err), wantCode)
+			}
+			if _, _, err = invoke(context.Background(), s, "widget", "stable", Data{}); err != nil {
+				t.Errorf("unexpected error for an unguarded action : %v", err)
+			}
+		})
+	}
+}
+
+func TestGuardedByFlagToggle(t *testing.T) {
+	flags := stubFlags{"beta": true}
+	s := newTestServer(t, WithFlagEvaluator(flags))
+	s.CreateWidget("widget").AddAction("guarded", pb.MethodKind_GET, "/guarded", noopHandler, GuardedByFlag("beta"))
+
+	if _, _, err := invoke(context.Background(), s, "widget", "guarded", Data{}); err != nil {
+		t.Fatalf("unexpected error with the flag on : %v", err)
+	}
+	flags["beta"] = false
+	response, err := s.Handler().GetWidget(context.Background(), &pb.WidgetRequest{Name: "widget"})
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	if len(response.Actions) != 0 {
+		t.Errorf("got %d actions after turning the flag off, want 0", len(response.Actions))
+	}
+	if _, _, err = invoke(context.Background(), s, "widget", "guarded", Data{}); status.Code(err) != codes.NotFound {
+		t.Errorf("got code %v after turning the flag off, want %v", status.Code(err), codes.NotFound)
+	}
+}
+
+func TestHasAction(t *testing.T) {
+	s := newTestServer(t, WithFlagEvaluator(stubFlags{"beta": false}))
+	widget := s.CreateWidget("widget")
+	widget.AddAction("stable", pb.MethodKind_GET, "/stable", noopHandler)
+	widget.AddAction("guarded", pb.MethodKind_GET, "/guarded", noopHandler, GuardedByFlag("beta"))
+
+	tests := []struct {
+		widgetName string
+		actionName string
+		want       bool
+	}{
+		{widgetName: "widget", actionName: "stable", want: true},
+		{widgetName: "widget", actionName: "guarded", want: false},
+		{widgetName: "widget", actionName: "missing", want: false},
+		{widgetName: "missing", actionName: "stable", want: false},
+	}
+	for _, tt := range tests {
+		if got := s.HasAction(context.Background(), tt.widgetName, tt.actionName, nil); got != tt.want {
+			t.Errorf("HasAction(%q, %q) = %v, want %v", tt.widgetName, tt.actionName, got, tt.want)
+		}
+	}
+}
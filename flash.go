@@ -0,0 +1,106 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// binary header (the message could contain any character), one value per flash message
+const flashHeader = headerPrefix + "flash-bin"
+
+// not reserved (see ReservedKeys) because it is only used in the data passed to the handler
+const pendingFlashesKey = "puzzleflashes.pending"
+
+type Flash struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// Queue a flash message for the frontend (message is resolved as a key with Localize), it is sent in the response
+// along with the redirect or template as a json encoded Flash in the "puzzle-flash-bin" header metadata
+// (one value per message, in call order). The frontend is expected to keep the messages in its flash store and display them on the page rendered after
+// the redirect (or on the rendered template when there is no redirect).
+func SetFlash(ctx context.Context, level string, message string) error {
+	flashBytes, err := json.Marshal(Flash{Level: level, Message: Localize(ctx, message)})
+	if err != nil {
+		return err
+	}
+	return grpc.SetHeader(ctx, metadata.Pairs(flashHeader, string(flashBytes)))
+}
+
+// Handler return values for a redirect carrying a flash message (Post/Redirect/Get pattern) :
+//
+//	return RedirectWithFlash(ctx, listUrl, "success", "Item saved")
+func RedirectWithFlash(ctx context.Context, redirect string, level string, message string) (string, string, []byte, error) {
+	if err := SetFlash(ctx, level, message); err != nil {
+		return "", "", nil, err
+	}
+	return redirect, "", nil, nil
+}
+
+// Like SetFlash for code without access to the context (the message is sent after the handler returns,
+// following the ones queued with SetFlash).
+func AddFlash(data Data, level string, message string) {
+	pending, _ := data[pendingFlashesKey].([]Flash)
+	data[pendingFlashesKey] = append(pending, Flash{Level: level, Message: message})
+}
+
+// Return the flash messages the frontend forwarded in the "Flashes" entry (the ones queued
+// by a previous call, to display on the current page).
+func GetFlashes(data Data) ([]Flash, error) {
+	values, err := AsSliceOfMaps(data[FlashesKey])
+	if err != nil {
+		return nil, err
+	}
+	flashes := make([]Flash, 0, len(values))
+	for _, value := range values {
+		level, err := AsString(value["level"])
+		if err != nil {
+			return nil, err
+		}
+		message, err := AsString(value["message"])
+		if err != nil {
+			return nil, err
+		}
+		flashes = append(flashes, Flash{Level: level, Message: message})
+	}
+	return flashes, nil
+}
+
+func sendPendingFlashes(ctx context.Context, data Data) error {
+	pending, _ := data[pendingFlashesKey].([]Flash)
+	if len(pending) == 0 {
+		return nil
+	}
+	pairs := make([]string, 0, 2*len(pending))
+	for _, flash := range pending {
+		flash.Message = Localize(ctx, flash.Message)
+		flashBytes, err := json.Marshal(flash)
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, flashHeader, string(flashBytes))
+	}
+	return grpc.SetHeader(ctx, metadata.Pairs(pairs...))
+}
@@ -0,0 +1,51 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import "encoding/json"
+
+const drawName = "draw"
+
+type gridResponse struct {
+	Draw            uint64 `json:"draw"`
+	RecordsTotal    uint64 `json:"recordsTotal"`
+	RecordsFiltered uint64 `json:"recordsFiltered"`
+	Data            []any  `json:"data"`
+}
+
+// Query parameter names to transmit for a grid endpoint (see AddActionWithQuery).
+func GetGridNames() []string {
+	return []string{drawName, "start", "length", "search[value]"}
+}
+
+// Return the draw counter sent by the grid component (zero when absent or invalid).
+func GetGridDraw(data Data) uint64 {
+	draw, _ := GetQueryUint64(data, drawName)
+	return draw
+}
+
+// Marshal rows in the shape expected by DataTables like grid components,
+// intended to be returned by a RAW action.
+func BuildGridResponse(draw uint64, total uint64, filtered uint64, rows []any) ([]byte, error) {
+	if rows == nil {
+		// the component expect an array even when empty
+		rows = []any{}
+	}
+	return json.Marshal(gridResponse{Draw: draw, RecordsTotal: total, RecordsFiltered: filtered, Data: rows})
+}
@@ -0,0 +1,158 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const defaultHealthCheckInterval = 10 * time.Second
+
+// status of the grpc.health.v1 service, the overall status (empty service name)
+// is SERVING when the server is ready and every widget check succeeds
+type healthState struct {
+	mutex   sync.Mutex
+	server  *health.Server
+	ready   bool
+	checks  map[string]func(context.Context) error
+	healthy map[string]bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func newHealthState() *healthState {
+	ctx, cancel := context.WithCancel(context.Background())
+	state := &healthState{
+		server: health.NewServer(), ready: true, checks: map[string]func(context.Context) error{}, healthy: map[string]bool{},
+		ctx: ctx, cancel: cancel,
+	}
+	state.server.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	return state
+}
+
+// Interval between two runs of the health checks (default to 10 seconds), each check must answer within it.
+func WithHealthCheckInterval(interval time.Duration) Option {
+	return func(o *serverOptions) {
+		o.healthCheckInterval = interval
+	}
+}
+
+// Change the readiness reported by the grpc health service (true by default),
+// to answer NOT_SERVING while warming up or before a maintenance.
+func (s WidgetServer) SetReady(ready bool) {
+	s.health.mutex.Lock()
+	defer s.health.mutex.Unlock()
+
+	s.health.ready = ready
+	s.health.updateOverall()
+}
+
+// Register a periodic health check of a widget (a database ping, etc.), its result is reported
+// by the grpc health service under the widget name and a failure makes the overall status NOT_SERVING.
+func (s WidgetServer) AddHealthCheck(widgetName string, check func(context.Context) error) {
+	s.health.mutex.Lock()
+	defer s.health.mutex.Unlock()
+
+	s.health.checks[widgetName] = check
+	// unknown until the first run
+	s.health.healthy[widgetName] = true
+	s.health.server.SetServingStatus(widgetName, healthpb.HealthCheckResponse_SERVING)
+}
+
+// run the checks every interval until stop is called
+func (h *healthState) watch(interval time.Duration, logger *otelzap.Logger) {
+	ctx := h.ctx
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		h.mutex.Lock()
+		names := make([]string, 0, len(h.checks))
+		checks := make([]func(context.Context) error, 0, len(h.checks))
+		for name := range h.checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			checks = append(checks, h.checks[name])
+		}
+		h.mutex.Unlock()
+
+		results := make([]bool, len(checks))
+		for i, check := range checks {
+			checkCtx, cancel := context.WithTimeout(ctx, interval)
+			err := check(checkCtx)
+			cancel()
+			if err != nil {
+				logger.WarnContext(ctx, "Health check failed", zap.String("widget", names[i]), zap.Error(err))
+			}
+			results[i] = err == nil
+		}
+
+		h.mutex.Lock()
+		for i, name := range names {
+			if _, ok := h.checks[name]; !ok {
+				continue
+			}
+			h.healthy[name] = results[i]
+			h.server.SetServingStatus(name, servingStatus(results[i]))
+		}
+		h.updateOverall()
+		h.mutex.Unlock()
+	}
+}
+
+// every status become NOT_SERVING (the server is shutting down)
+func (h *healthState) stop() {
+	h.cancel()
+	h.server.Shutdown()
+}
+
+// should be called with the lock held
+func (h *healthState) updateOverall() {
+	serving := h.ready
+	for _, healthy := range h.healthy {
+		serving = serving && healthy
+	}
+	h.server.SetServingStatus("", servingStatus(serving))
+}
+
+func servingStatus(serving bool) healthpb.HealthCheckResponse_ServingStatus {
+	if serving {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
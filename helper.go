@@ -19,18 +19,35 @@
 package puzzlewidgetserver
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 var errNotInt = errors.New("value is not an int")
+var errIntOverflow = errors.New("value overflows an int64")
+var errUintOverflow = errors.New("value overflows an uint64")
+var errNegative = errors.New("value is negative")
+var errNotWhole = errors.New("value has a fractional part")
 var errNotFloat = errors.New("value is not an float")
+var errNotBool = errors.New("value is not a bool")
+var errNotTime = errors.New("value is not a time")
+var errNotDuration = errors.New("value is not a duration")
 var errNotMap = errors.New("value is not a map")
 var errNotSlice = errors.New("value is not a slice")
 var errNotString = errors.New("value is not a string")
+var errElemType = errors.New("element is not of the expected type")
 var errFilesType = errors.New("field Files is not of the expected type")
 var errEmptyUrl = errors.New("field CurrentUrl is empty")
+var errTooManyLevels = errors.New("more levels to erase than path segments")
 var errNoUser = errors.New("field Id is 0")
+var errNotUuid = errors.New("value is not an uuid")
+var errUnsafeRedirect = errors.New("redirect target is outside of the current site")
 
 func AsMap(value any) (Data, error) {
 	if value == nil {
@@ -54,6 +71,64 @@ func AsSlice(value any) ([]any, error) {
 	return s, nil
 }
 
+// Convert a slice of maps (like an array of json objects).
+func AsSliceOfMaps(value any) ([]Data, error) {
+	s, err := AsSlice(value)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	res := make([]Data, 0, len(s))
+	for _, elem := range s {
+		m, err := AsMap(elem)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+// Convert a slice whose elements are all of type T (like []string or []Data from decoded json),
+// the error indicates the index of the first element of another type.
+func AsSliceOf[T any](value any) ([]T, error) {
+	if typed, ok := value.([]T); ok {
+		return typed, nil
+	}
+	s, err := AsSlice(value)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	res := make([]T, 0, len(s))
+	for i, elem := range s {
+		typed, ok := elem.(T)
+		if !ok {
+			return nil, fmt.Errorf("element %d: %w", i, errElemType)
+		}
+		res = append(res, typed)
+	}
+	return res, nil
+}
+
+// Convert a map whose values are all of type T, the error indicates the key of a value of another type.
+func AsMapOf[T any](value any) (map[string]T, error) {
+	if typed, ok := value.(map[string]T); ok {
+		return typed, nil
+	}
+	m, err := AsMap(value)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	res := make(map[string]T, len(m))
+	for key, elem := range m {
+		typed, ok := elem.(T)
+		if !ok {
+			return nil, fmt.Errorf("element %q: %w", key, errElemType)
+		}
+		res[key] = typed
+	}
+	return res, nil
+}
+
 func AsString(value any) (string, error) {
 	if value == nil {
 		return "", nil
@@ -65,6 +140,7 @@ func AsString(value any) (string, error) {
 	return s, nil
 }
 
+// Negative values and floats with a fractional part are rejected.
 func AsUint64(value any) (uint64, error) {
 	if value == nil {
 		return 0, nil
@@ -81,19 +157,31 @@ func AsUint64(value any) (uint64, error) {
 	case uint64:
 		return uint64(casted), nil
 	case int:
-		return uint64(casted), nil
+		return intToUint64(int64(casted))
 	case int8:
-		return uint64(casted), nil
+		return intToUint64(int64(casted))
 	case int16:
-		return uint64(casted), nil
+		return intToUint64(int64(casted))
 	case int32:
-		return uint64(casted), nil
+		return intToUint64(int64(casted))
 	case int64:
-		return uint64(casted), nil
+		return intToUint64(casted)
 	case float32:
-		return uint64(casted), nil
+		return floatToUint64(float64(casted))
 	case float64:
-		return uint64(casted), nil
+		return floatToUint64(casted)
+	case json.Number:
+		if i, err := strconv.ParseUint(string(casted), 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := casted.Float64()
+		if err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return 0, errUintOverflow
+			}
+			return 0, errNotInt
+		}
+		return floatToUint64(f)
 	case string:
 		i, err := strconv.ParseUint(casted, 10, 64)
 		if err != nil {
@@ -104,6 +192,95 @@ func AsUint64(value any) (uint64, error) {
 	return 0, errNotInt
 }
 
+func intToUint64(value int64) (uint64, error) {
+	if value < 0 {
+		return 0, errNegative
+	}
+	return uint64(value), nil
+}
+
+func floatToUint64(value float64) (uint64, error) {
+	if value < 0 {
+		return 0, errNegative
+	}
+	if value != math.Trunc(value) {
+		return 0, errNotWhole
+	}
+	if value >= 1<<64 {
+		return 0, errUintOverflow
+	}
+	return uint64(value), nil
+}
+
+func AsInt64(value any) (int64, error) {
+	if value == nil {
+		return 0, nil
+	}
+	switch casted := value.(type) {
+	case uint:
+		return uintToInt64(uint64(casted))
+	case uint8:
+		return int64(casted), nil
+	case uint16:
+		return int64(casted), nil
+	case uint32:
+		return int64(casted), nil
+	case uint64:
+		return uintToInt64(casted)
+	case int:
+		return int64(casted), nil
+	case int8:
+		return int64(casted), nil
+	case int16:
+		return int64(casted), nil
+	case int32:
+		return int64(casted), nil
+	case int64:
+		return casted, nil
+	case float32:
+		return floatToInt64(float64(casted))
+	case float64:
+		return floatToInt64(casted)
+	case json.Number:
+		if i, err := casted.Int64(); err == nil {
+			return i, nil
+		}
+		// out of range or written with a fraction or an exponent
+		f, err := casted.Float64()
+		if err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return 0, errIntOverflow
+			}
+			return 0, errNotInt
+		}
+		return floatToInt64(f)
+	case string:
+		i, err := strconv.ParseInt(casted, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return i, nil
+	}
+	return 0, errNotInt
+}
+
+func uintToInt64(value uint64) (int64, error) {
+	if value > math.MaxInt64 {
+		return 0, errIntOverflow
+	}
+	return int64(value), nil
+}
+
+func floatToInt64(value float64) (int64, error) {
+	if value != math.Trunc(value) {
+		return 0, errNotInt
+	}
+	if value >= 1<<63 || value < -1<<63 {
+		return 0, errIntOverflow
+	}
+	return int64(value), nil
+}
+
 func AsFloat64(value any) (float64, error) {
 	if value == nil {
 		return 0, nil
@@ -133,6 +310,8 @@ func AsFloat64(value any) (float64, error) {
 		return float64(casted), nil
 	case float64:
 		return casted, nil
+	case json.Number:
+		return casted.Float64()
 	case string:
 		f, err := strconv.ParseFloat(casted, 64)
 		if err != nil {
@@ -143,12 +322,177 @@ func AsFloat64(value any) (float64, error) {
 	return 0, errNotFloat
 }
 
+// Accept bool, numbers (true when not zero) and strings
+// like "true", "on", "yes", "1" or "false", "off", "no", "0" (case insensitive).
+func AsBool(value any) (bool, error) {
+	if value == nil {
+		return false, nil
+	}
+	switch casted := value.(type) {
+	case bool:
+		return casted, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(casted)) {
+		case "true", "on", "yes", "1":
+			return true, nil
+		case "", "false", "off", "no", "0":
+			return false, nil
+		}
+		return false, errNotBool
+	}
+	f, err := AsFloat64(value)
+	if err != nil {
+		return false, errNotBool
+	}
+	return f != 0, nil
+}
+
+// Accepted string layouts of AsTime, in order (RFC 3339 then the formats of html date and time inputs).
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02", "15:04:05", "15:04"}
+
+// Convert a time.Time, a string in one of the timeLayouts (an empty string gives the zero time)
+// or a number of seconds since the unix epoch.
+func AsTime(value any) (time.Time, error) {
+	if value == nil {
+		return time.Time{}, nil
+	}
+	switch casted := value.(type) {
+	case time.Time:
+		return casted, nil
+	case string:
+		casted = strings.TrimSpace(casted)
+		if casted == "" {
+			return time.Time{}, nil
+		}
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, casted); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, errNotTime
+	}
+	seconds, err := AsFloat64(value)
+	if err != nil {
+		return time.Time{}, errNotTime
+	}
+	intPart, fracPart := math.Modf(seconds)
+	return time.Unix(int64(intPart), int64(fracPart*1e9)), nil
+}
+
+// Convert a time.Duration, a string parsed by time.ParseDuration ("1h30m", an empty string gives zero)
+// or a number of seconds.
+func AsDuration(value any) (time.Duration, error) {
+	if value == nil {
+		return 0, nil
+	}
+	switch casted := value.(type) {
+	case time.Duration:
+		return casted, nil
+	case string:
+		casted = strings.TrimSpace(casted)
+		if casted == "" {
+			return 0, nil
+		}
+		if d, err := time.ParseDuration(casted); err == nil {
+			return d, nil
+		}
+	}
+	seconds, err := AsFloat64(value)
+	if err != nil {
+		return 0, errNotDuration
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Return nil when the key is absent (or its value is nil or an empty string),
+// otherwise a pointer to the value converted with AsBool.
+func GetOptionalBool(data Data, key string) (*bool, error) {
+	value := data[key]
+	if s, ok := value.(string); value == nil || (ok && strings.TrimSpace(s) == "") {
+		return nil, nil
+	}
+	b, err := AsBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Split a free text value on commas and newlines, elements are trimmed and empty ones dropped.
+func GetList(data Data, key string) ([]string, error) {
+	value, err := AsString(data[key])
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.FieldsFunc(value, isListSeparator)
+	res := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			res = append(res, part)
+		}
+	}
+	return res, nil
+}
+
+// Like GetList but without duplicates (the first occurrence order is kept).
+func GetDistinctList(data Data, key string) ([]string, error) {
+	list, err := GetList(data, key)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(list))
+	res := list[:0]
+	for _, elem := range list {
+		if _, ok := seen[elem]; !ok {
+			seen[elem] = struct{}{}
+			res = append(res, elem)
+		}
+	}
+	return res, nil
+}
+
+func isListSeparator(r rune) bool {
+	return r == ',' || r == '\n' || r == '\r'
+}
+
+// Check that the value is an uuid (8-4-4-4-12 hexadecimal digits, any version)
+// and return it in lower case.
+func GetUuid(data Data, key string) (string, error) {
+	value, err := AsString(data[key])
+	if err != nil {
+		return "", err
+	}
+	if len(value) != 36 {
+		return "", errNotUuid
+	}
+	for i, c := range value {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return "", errNotUuid
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return "", errNotUuid
+			}
+		}
+	}
+	return strings.ToLower(value), nil
+}
+
+// Same as GetUuid with the "pathData/name" entry.
+func GetUuidParam(data Data, name string) (string, error) {
+	return GetUuid(data, PathDataPrefix+name)
+}
+
 func GetFormData(data Data) (Data, error) {
-	return AsMap(data[formKey])
+	return AsMap(data[FormKey])
 }
 
 func GetFiles(data Data) (map[string][]byte, error) {
-	value := data[filesKey]
+	value := data[FilesKey]
 	if value == nil {
 		return nil, nil
 	}
@@ -159,27 +503,133 @@ func GetFiles(data Data) (map[string][]byte, error) {
 	return m, nil
 }
 
+// Return the "CurrentUrl" entry without its query and fragment, and with its last levelToErase
+// path segments removed ("http://host/a/b/c" with 1 gives "http://host/a/b/").
+// An error is returned when levelToErase exceeds the number of path segments.
 func GetBaseUrl(levelToErase uint8, data Data) (string, error) {
-	res, err := AsString(data[urlKey])
+	current, err := AsString(data[CurrentUrlKey])
+	if err != nil {
+		return "", err
+	}
+	if current == "" {
+		return "", errEmptyUrl
+	}
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	base.RawQuery = ""
+	base.ForceQuery = false
+	base.Fragment = ""
+	base.RawFragment = ""
+	if levelToErase == 0 {
+		return base.String(), nil
+	}
+
+	trimmed := strings.Trim(base.EscapedPath(), "/")
+	var segments []string
+	if trimmed != "" {
+		segments = strings.Split(trimmed, "/")
+	}
+	if int(levelToErase) > len(segments) {
+		return "", fmt.Errorf("%w : can not erase %d levels from %q", errTooManyLevels, levelToErase, current)
+	}
+
+	kept := segments[:len(segments)-int(levelToErase)]
+	escapedPath := "/"
+	if len(kept) != 0 {
+		escapedPath += strings.Join(kept, "/") + "/"
+	}
+	if base.Path, err = url.PathUnescape(escapedPath); err != nil {
+		return "", err
+	}
+	base.RawPath = escapedPath
+	return base.String(), nil
+}
+
+// Append the segments (escaped, so they can contain "/" or spaces) to the path of base,
+// its query and fragment are kept.
+func JoinUrl(base string, segments ...string) (string, error) {
+	u, err := url.Parse(base)
 	if err != nil {
 		return "", err
 	}
 
-	i := len(res) - 1
-	if i == -1 {
+	escapedSegments := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		escapedSegments = append(escapedSegments, url.PathEscape(segment))
+	}
+	return u.JoinPath(escapedSegments...).String(), nil
+}
+
+// Build a redirect target from path (resolved against the "CurrentUrl" entry when relative),
+// params are added to the query of path, overriding the values with the same name.
+// An error is returned when the result would leave the current site.
+func RedirectWithParams(data Data, path string, params url.Values) (string, error) {
+	current, err := AsString(data[CurrentUrlKey])
+	if err != nil {
+		return "", err
+	}
+	if current == "" {
 		return "", errEmptyUrl
 	}
-	for count := uint8(0); count < levelToErase; {
-		i--
-		if res[i] == '/' {
-			count++
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+
+	target := base.ResolveReference(ref)
+	if target.Scheme != base.Scheme || target.Host != base.Host {
+		return "", errUnsafeRedirect
+	}
+
+	query := target.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// Read the navigation history forwarded by the frontend in the "History" entry
+// (visited urls, the most recent last).
+func GetHistory(data Data) ([]string, error) {
+	values, err := AsSlice(data[HistoryKey])
+	if err != nil {
+		return nil, err
+	}
+	history := make([]string, 0, len(values))
+	for _, value := range values {
+		entry, err := AsString(value)
+		if err != nil {
+			return nil, err
 		}
+		history = append(history, entry)
 	}
-	return res[:i+1], nil
+	return history, nil
+}
+
+// Return the url visited steps pages before (1 for the previous page) in the history,
+// the base url (see GetBaseUrl) is returned when the history is too short.
+// An entry outside of the current site is rejected with an error.
+func GetBackUrl(data Data, steps int) (string, error) {
+	history, err := GetHistory(data)
+	if err != nil {
+		return "", err
+	}
+	index := len(history) - steps
+	if steps < 1 || index < 0 {
+		return GetBaseUrl(0, data)
+	}
+	return RedirectWithParams(data, history[index], nil)
 }
 
 func GetCurrentUserId(data Data) (uint64, error) {
-	res, err := AsUint64(data[userKey])
+	res, err := AsUint64(data[UserIdKey])
 	if err != nil {
 		return 0, err
 	}
@@ -189,27 +639,69 @@ func GetCurrentUserId(data Data) (uint64, error) {
 	return res, nil
 }
 
+// Limits applied to the pagination query parameters, so a crafted query string can not
+// ask for a huge page or an absurd offset.
+const (
+	MaxPageNumber      = 1000000
+	DefaultMaxPageSize = 1000
+)
+
 func GetPaginationNames() []string {
 	return []string{"pageNumber", "pageSize", "filter"}
 }
 
+// The page size is clamped to DefaultMaxPageSize (or defaultPageSize when greater)
+// and the page number to MaxPageNumber, the returned values are the clamped ones.
 func GetPagination(defaultPageSize uint64, data Data) (uint64, uint64, uint64, string) {
-	pageNumber, _ := AsUint64(data["queryData/pageNumber"])
+	return GetBoundedPagination(defaultPageSize, defaultMaxPageSize(defaultPageSize), data)
+}
+
+func defaultMaxPageSize(defaultPageSize uint64) uint64 {
+	if defaultPageSize > DefaultMaxPageSize {
+		return defaultPageSize
+	}
+	return DefaultMaxPageSize
+}
+
+// Like GetPagination but the page size is clamped to maxPageSize (zero means no limit).
+func GetBoundedPagination(defaultPageSize uint64, maxPageSize uint64, data Data) (uint64, uint64, uint64, string) {
+	pageNumber, _ := GetQueryUint64(data, "pageNumber")
 	if pageNumber == 0 {
 		pageNumber = 1
 	}
-	pageSize, _ := AsUint64(data["queryData/pageSize"])
-	if pageSize == 0 {
-		pageSize = defaultPageSize
+	if pageNumber > MaxPageNumber {
+		pageNumber = MaxPageNumber
 	}
-	filter, _ := AsString(data["queryData/filter"])
+	pageSize := getPageSize(defaultPageSize, maxPageSize, data)
+	filter, _ := GetQueryString(data, "filter")
 
+	if pageSize != 0 {
+		// end = pageNumber * pageSize must fit in an int64 (a database offset)
+		if maxPageNumber := math.MaxInt64 / pageSize; pageNumber > maxPageNumber {
+			pageNumber = maxPageNumber
+		}
+	}
 	start := (pageNumber - 1) * pageSize
 	end := start + pageSize
 
 	return pageNumber, start, end, filter
 }
 
+// the page size is clamped to maxPageSize (zero means no limit) and to fit in an int64
+func getPageSize(defaultPageSize uint64, maxPageSize uint64, data Data) uint64 {
+	pageSize, _ := GetQueryUint64(data, "pageSize")
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if maxPageSize != 0 && pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	if pageSize > math.MaxInt64 {
+		pageSize = math.MaxInt64
+	}
+	return pageSize
+}
+
 func InitPagination(data Data, filter string, pageNumber uint64, end uint64, total uint64) {
 	data["Filter"] = filter
 	if pageNumber != 1 {
@@ -0,0 +1,288 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"encoding/json"
+	"math"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestRedirectWithParams(t *testing.T) {
+	data := Data{CurrentUrlKey: "http://site.test/widget/list?filter=a"}
+	tests := []struct {
+		name    string
+		path    string
+		params  url.Values
+		want    string
+		wantErr error
+	}{
+		{name: "adding", path: "/widget/list?filter=a", params: url.Values{"page": {"2"}}, want: "http://site.test/widget/list?filter=a&page=2"},
+		{name: "overriding", path: "view?page=1", params: url.Values{"page": {"3"}}, want: "http://site.test/widget/view?page=3"},
+		{name: "preserving", path: "", want: "http://site.test/widget/list?filter=a"},
+		{name: "encoding", path: "/search", params: url.Values{"q": {"a b&c"}}, want: "http://site.test/search?q=a+b%26c"},
+		{name: "cross host", path: "http://other.test/list", wantErr: errUnsafeRedirect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RedirectWithParams(data, tt.path, tt.params)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOptionalBool(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    Data
+		want    *bool
+		wantErr error
+	}{
+		{name: "absent", data: Data{}, want: nil},
+		{name: "empty", data: Data{"value": " "}, want: nil},
+		{name: "true", data: Data{"value": "true"}, want: boolPointer(true)},
+		{name: "false", data: Data{"value": "false"}, want: boolPointer(false)},
+		{name: "checkbox", data: Data{"value": "on"}, want: boolPointer(true)},
+		{name: "invalid", data: Data{"value": "maybe"}, wantErr: errNotBool},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetOptionalBool(tt.data, "value")
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil:
+				t.Errorf("got %v, want %v", got, tt.want)
+			case *got != *tt.want:
+				t.Errorf("got %v, want %v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func boolPointer(b bool) *bool {
+	return &b
+}
+
+func TestGetList(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		want     []string
+		distinct []string
+	}{
+		{name: "comma separated", value: "a, b,c", want: []string{"a", "b", "c"}, distinct: []string{"a", "b", "c"}},
+		{name: "newline separated", value: "a\nb\r\nc\n", want: []string{"a", "b", "c"}, distinct: []string{"a", "b", "c"}},
+		{name: "mixed", value: "a,b\n c ,, a", want: []string{"a", "b", "c", "a"}, distinct: []string{"a", "b", "c"}},
+		{name: "empty", value: "", want: []string{}, distinct: []string{}},
+		{name: "absent", value: nil, want: []string{}, distinct: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := Data{"value": tt.value}
+			got, err := GetList(data, "value")
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			distinct, err := GetDistinctList(data, "value")
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if !reflect.DeepEqual(distinct, tt.distinct) {
+				t.Errorf("got distinct %q, want %q", distinct, tt.distinct)
+			}
+		})
+	}
+}
+
+func TestGetUuid(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		want    string
+		wantErr error
+	}{
+		{name: "valid", value: "123e4567-e89b-12d3-a456-426614174000", want: "123e4567-e89b-12d3-a456-426614174000"},
+		{name: "upper case", value: "123E4567-E89B-12D3-A456-426614174000", want: "123e4567-e89b-12d3-a456-426614174000"},
+		{name: "wrong length", value: "123e4567-e89b-12d3-a456-42661417400", wantErr: errNotUuid},
+		{name: "non hex", value: "123e4567-e89b-12d3-a456-42661417400g", wantErr: errNotUuid},
+		{name: "misplaced dash", value: "123e4567e-89b-12d3-a456-426614174000", wantErr: errNotUuid},
+		{name: "absent", value: nil, wantErr: errNotUuid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetUuid(Data{"value": tt.value}, "value")
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	got, err := GetUuidParam(Data{PathDataPrefix + "id": "123E4567-E89B-12D3-A456-426614174000"}, "id")
+	if err != nil || got != "123e4567-e89b-12d3-a456-426614174000" {
+		t.Errorf("got %q and error %v from GetUuidParam", got, err)
+	}
+}
+
+func TestGetBackUrl(t *testing.T) {
+	history := []any{"http://site.test/home", "/widget/list?page=2", "http://other.test/phishing", "http://site.test/widget/view/1"}
+	tests := []struct {
+		name    string
+		history []any
+		steps   int
+		want    string
+		wantErr error
+	}{
+		{name: "previous", history: history, steps: 1, want: "http://site.test/widget/view/1"},
+		{name: "relative entry", history: history, steps: 3, want: "http://site.test/widget/list?page=2"},
+		{name: "oldest", history: history, steps: 4, want: "http://site.test/home"},
+		{name: "cross host", history: history, steps: 2, wantErr: errUnsafeRedirect},
+		{name: "too short", history: history, steps: 5, want: "http://site.test/widget/edit/1"},
+		{name: "no step", history: history, steps: 0, want: "http://site.test/widget/edit/1"},
+		{name: "no history", steps: 1, want: "http://site.test/widget/edit/1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := Data{CurrentUrlKey: "http://site.test/widget/edit/1?tab=2#top", HistoryKey: tt.history}
+			got, err := GetBackUrl(data, tt.steps)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsInt64(t *testing.T) {
+	tests := []struct {
+		value   any
+		want    int64
+		wantErr error
+	}{
+		{value: json.Number("42"), want: 42},
+		{value: json.Number("-42"), want: -42},
+		{value: json.Number("1e3"), want: 1000},
+		{value: json.Number("9223372036854775807"), want: 9223372036854775807},
+		{value: json.Number("9223372036854775808"), wantErr: errIntOverflow},
+		{value: json.Number("1e19"), wantErr: errIntOverflow},
+		{value: json.Number("1e400"), wantErr: errIntOverflow},
+		{value: json.Number("2.5"), wantErr: errNotInt},
+		{value: json.Number("abc"), wantErr: errNotInt},
+		{value: float64(7), want: 7},
+		{value: 7.5, wantErr: errNotInt},
+		{value: float64(1 << 63), wantErr: errIntOverflow},
+		{value: float64(-1 << 63), want: -1 << 63},
+		{value: uint64(1 << 63), wantErr: errIntOverflow},
+	}
+	for _, tt := range tests {
+		got, err := AsInt64(tt.value)
+		if err != tt.wantErr {
+			t.Errorf("AsInt64(%v) got error %v, want %v", tt.value, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("AsInt64(%v) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestAsUint64JsonNumber(t *testing.T) {
+	tests := []struct {
+		value   json.Number
+		want    uint64
+		wantErr error
+	}{
+		{value: "18446744073709551615", want: 18446744073709551615},
+		{value: "18446744073709551616", wantErr: errUintOverflow},
+		{value: "1e400", wantErr: errUintOverflow},
+		{value: "2e3", want: 2000},
+		{value: "2.5", wantErr: errNotWhole},
+		{value: "-1", wantErr: errNegative},
+	}
+	for _, tt := range tests {
+		got, err := AsUint64(tt.value)
+		if err != tt.wantErr {
+			t.Errorf("AsUint64(%v) got error %v, want %v", tt.value, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("AsUint64(%v) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func paginationQuery(pageNumber string, pageSize string) Data {
+	return Data{QueryDataPrefix + "pageNumber": pageNumber, QueryDataPrefix + "pageSize": pageSize, QueryDataPrefix + "filter": "a"}
+}
+
+func TestGetPagination(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultPageSize uint64
+		data            Data
+		wantPageNumber  uint64
+		wantStart       uint64
+		wantEnd         uint64
+	}{
+		{name: "defaults", defaultPageSize: 10, data: Data{}, wantPageNumber: 1, wantStart: 0, wantEnd: 10},
+		{name: "third page", defaultPageSize: 10, data: paginationQuery("3", "20"), wantPageNumber: 3, wantStart: 40, wantEnd: 60},
+		{name: "huge page size", defaultPageSize: 10, data: paginationQuery("2", "1000000000"), wantPageNumber: 2, wantStart: 1000, wantEnd: 2000},
+		{name: "large default", defaultPageSize: 5000, data: paginationQuery("2", ""), wantPageNumber: 2, wantStart: 5000, wantEnd: 10000},
+		{
+			name: "absurd page number", defaultPageSize: 10, data: paginationQuery("1000000000000000000", ""),
+			wantPageNumber: MaxPageNumber, wantStart: (MaxPageNumber - 1) * 10, wantEnd: MaxPageNumber * 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pageNumber, start, end, _ := GetPagination(tt.defaultPageSize, tt.data)
+			if pageNumber != tt.wantPageNumber || start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("got (%d, %d, %d), want (%d, %d, %d)", pageNumber, start, end, tt.wantPageNumber, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestGetBoundedPagination(t *testing.T) {
+	pageNumber, start, end, filter := GetBoundedPagination(10, 50, paginationQuery("1000000000000000000", "100"))
+	if pageNumber != MaxPageNumber || start != (MaxPageNumber-1)*50 || end != MaxPageNumber*50 || filter != "a" {
+		t.Errorf("got (%d, %d, %d, %q)", pageNumber, start, end, filter)
+	}
+
+	// without page size limit, the offset still fits in an int64
+	pageNumber, start, end, _ = GetBoundedPagination(10, 0, paginationQuery("3", "18446744073709551615"))
+	if pageNumber != 1 || start != 0 || end != math.MaxInt64 {
+		t.Errorf("got (%d, %d, %d) without limit", pageNumber, start, end)
+	}
+}
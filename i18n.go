@@ -0,0 +1,74 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import "context"
+
+// MessageCatalog resolve message keys, Translate should return an empty string
+// when there is no translation for the key in the locale.
+type MessageCatalog interface {
+	Translate(locale string, key string, args ...any) string
+}
+
+type localizer struct {
+	catalog MessageCatalog
+	locale  string
+}
+
+// Use catalog to resolve the messages of handlers (see Localize).
+func WithMessageCatalog(catalog MessageCatalog) Option {
+	return func(o *serverOptions) {
+		o.catalog = catalog
+	}
+}
+
+// Read the locale of the user in the key entry of the data forwarded by the frontend
+// instead of the "Lang" one (the value is copied in the "Lang" entry, so GetLocale keep working).
+func WithLocaleKey(key string) Option {
+	return func(o *serverOptions) {
+		o.localeKey = key
+	}
+}
+
+// Return the locale of the user (forwarded by the frontend in the "Lang" entry, see WithLocaleKey).
+func GetLocale(data Data) string {
+	locale, _ := AsString(data[LocaleKey])
+	return locale
+}
+
+// Resolve the message key with the catalog of the server in the locale of the call,
+// the key itself is returned when no catalog or translation exists.
+func Localize(ctx context.Context, key string, args ...any) string {
+	if l, ok := ctx.Value(localizerContextKey).(localizer); ok {
+		if message := l.catalog.Translate(l.locale, key, args...); message != "" {
+			return message
+		}
+	}
+	return key
+}
+
+func contextWithLocalizer(ctx context.Context, catalog MessageCatalog, data Data) context.Context {
+	return context.WithValue(ctx, localizerContextKey, localizer{catalog: catalog, locale: GetLocale(data)})
+}
+
+func copyLocale(data Data, localeKey string) {
+	if locale, ok := data[localeKey]; ok {
+		data[LocaleKey] = locale
+	}
+}
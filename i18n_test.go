@@ -0,0 +1,117 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type stubCatalog map[string]map[string]string
+
+func (c stubCatalog) Translate(locale string, key string, args ...any) string {
+	if message := c[locale][key]; message != "" {
+		return fmt.Sprintf(message, args...)
+	}
+	return ""
+}
+
+var testCatalog = stubCatalog{
+	"en": {"greeting": "Hello %s", "saved": "Item saved", "denied": "Access denied"},
+	"fr": {"greeting": "Bonjour %s", "saved": "Élément enregistré", "denied": "Accès refusé"},
+}
+
+func greetingHandler(ctx context.Context, data Data) (string, string, []byte, error) {
+	AddFlash(data, "success", "saved")
+	resData, err := json.Marshal(Data{"message": Localize(ctx, "greeting", "Ada")})
+	return "", "greeting", resData, err
+}
+
+func deniedHandler(ctx context.Context, data Data) (string, string, []byte, error) {
+	return "", "", nil, &WidgetError{Code: codes.PermissionDenied, UserMessage: "denied"}
+}
+
+func TestLocalize(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      []Option
+		data         Data
+		wantGreeting string
+		wantFlash    string
+		wantDenied   string
+	}{
+		{
+			name: "english", options: []Option{WithMessageCatalog(testCatalog)}, data: Data{LocaleKey: "en"},
+			wantGreeting: "Hello Ada", wantFlash: "Item saved", wantDenied: "Access denied",
+		},
+		{
+			name: "french", options: []Option{WithMessageCatalog(testCatalog)}, data: Data{LocaleKey: "fr"},
+			wantGreeting: "Bonjour Ada", wantFlash: "Élément enregistré", wantDenied: "Accès refusé",
+		},
+		{
+			name: "unknown locale", options: []Option{WithMessageCatalog(testCatalog)}, data: Data{LocaleKey: "de"},
+			wantGreeting: "greeting", wantFlash: "saved", wantDenied: "denied",
+		},
+		{
+			name: "no catalog", data: Data{LocaleKey: "fr"},
+			wantGreeting: "greeting", wantFlash: "saved", wantDenied: "denied",
+		},
+		{
+			name: "custom locale key", options: []Option{WithMessageCatalog(testCatalog), WithLocaleKey("locale")},
+			data: Data{"locale": "fr"}, wantGreeting: "Bonjour Ada", wantFlash: "Élément enregistré", wantDenied: "Accès refusé",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.options...)
+			widget := s.CreateWidget("test")
+			widget.AddAction("greet", pb.MethodKind_GET, "/greet", greetingHandler)
+			widget.AddAction("denied", pb.MethodKind_GET, "/denied", deniedHandler)
+
+			response, header, err := invoke(context.Background(), s, "test", "greet", tt.data)
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			var resData Data
+			if err = json.Unmarshal(response.Data, &resData); err != nil {
+				t.Fatalf("failed to decode data : %v", err)
+			}
+			if got := resData["message"]; got != tt.wantGreeting {
+				t.Errorf("got message %q, want %q", got, tt.wantGreeting)
+			}
+			var flash Flash
+			if values := header.Get(flashHeader); len(values) != 1 {
+				t.Errorf("got %d flash, want 1", len(values))
+			} else if err = json.Unmarshal([]byte(values[0]), &flash); err != nil || flash.Message != tt.wantFlash {
+				t.Errorf("got flash %q (%v), want %q", flash.Message, err, tt.wantFlash)
+			}
+
+			_, _, err = invoke(context.Background(), s, "test", "denied", tt.data)
+			if got := status.Convert(err).Message(); got != tt.wantDenied {
+				t.Errorf("got error message %q, want %q", got, tt.wantDenied)
+			}
+		})
+	}
+}
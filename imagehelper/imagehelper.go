@@ -0,0 +1,237 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Helpers for the images uploaded to widgets (jpeg, png and gif), working on the
+// raw bytes and only relying on the standard library.
+package imagehelper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const jpegQuality = 85
+
+// Maximum number of pixels (width x height) of the images decoded by Resize and Thumbnail,
+// checked from the image header before decoding (should be changed before any use).
+var MaxPixels int64 = 50_000_000
+
+// Returned when the image declares more pixels than MaxPixels.
+var ErrImageTooLarge = errors.New("image too large")
+
+var errInvalidSize = errors.New("invalid image size")
+var errUnsupportedFormat = errors.New("unsupported image format")
+var errMalformedJpeg = errors.New("malformed jpeg")
+var errMalformedPng = errors.New("malformed png")
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Scale the image to exactly width x height pixels, the result is encoded in the source format
+// (metadata like EXIF are not kept, the EXIF orientation is applied to the pixels).
+func Resize(content []byte, width int, height int) ([]byte, error) {
+	if width <= 0 || height <= 0 {
+		return nil, errInvalidSize
+	}
+	img, format, err := decode(content)
+	if err != nil {
+		return nil, err
+	}
+	return encode(scale(img, width, height), format)
+}
+
+// Scale the image down to fit in maxWidth x maxHeight pixels keeping its aspect ratio
+// (a smaller image is re-encoded without scaling), see Resize.
+func Thumbnail(content []byte, maxWidth int, maxHeight int) ([]byte, error) {
+	if maxWidth <= 0 || maxHeight <= 0 {
+		return nil, errInvalidSize
+	}
+	img, format, err := decode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxWidth || height > maxHeight {
+		if width*maxHeight > height*maxWidth {
+			width, height = maxWidth, ceilDiv(height*maxWidth, width)
+		} else {
+			width, height = ceilDiv(width*maxHeight, height), maxHeight
+		}
+		img = scale(img, width, height)
+	}
+	return encode(img, format)
+}
+
+// Remove the EXIF metadata (which can contain the gps position of the author) without
+// re-encoding the image : APP1 segments of a jpeg, eXIf chunks of a png.
+// Gif images are returned unchanged (the format has no EXIF).
+func StripExif(content []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xFF, 0xD8}):
+		return stripJpegExif(content)
+	case bytes.HasPrefix(content, pngSignature):
+		return stripPngExif(content)
+	case bytes.HasPrefix(content, []byte("GIF8")):
+		return content, nil
+	}
+	return nil, errUnsupportedFormat
+}
+
+// the size declared in the header is checked before allocating the pixels,
+// the returned image has its EXIF orientation applied
+func decode(content []byte) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, "", ErrImageTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", err
+	}
+	return orient(img, readOrientation(content)), format, nil
+}
+
+func encode(img image.Image, format string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: jpegQuality})
+	case "png":
+		err = png.Encode(&buffer, img)
+	case "gif":
+		err = gif.Encode(&buffer, img, nil)
+	default:
+		err = errUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// area averaging, each destination pixel is the mean of the source pixels it covers
+// (nearest source pixel when upscaling)
+func scale(src image.Image, width int, height int) image.Image {
+	rgba := toRGBA(src)
+	srcWidth, srcHeight := rgba.Rect.Dx(), rgba.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := maxInt(ceilDiv((y+1)*srcHeight, height), y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := maxInt(ceilDiv((x+1)*srcWidth, width), x0+1)
+
+			var r, g, b, a, count uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					offset := rgba.PixOffset(sx, sy)
+					r += uint32(rgba.Pix[offset])
+					g += uint32(rgba.Pix[offset+1])
+					b += uint32(rgba.Pix[offset+2])
+					a += uint32(rgba.Pix[offset+3])
+					count++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / count), G: uint8(g / count), B: uint8(b / count), A: uint8(a / count)})
+		}
+	}
+	return dst
+}
+
+// copy the pixels only when needed, the result bounds start at (0, 0)
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	return rgba
+}
+
+func ceilDiv(a int, b int) int {
+	return (a + b - 1) / b
+}
+
+// the max builtin needs go 1.21
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func stripJpegExif(content []byte) ([]byte, error) {
+	res := make([]byte, 0, len(content))
+	res = append(res, content[:2]...)
+	i := 2
+	for i < len(content) {
+		if i+4 > len(content) || content[i] != 0xFF {
+			return nil, errMalformedJpeg
+		}
+		marker := content[i+1]
+		if marker == 0xDA {
+			// start of scan, the remaining is the image data
+			return append(res, content[i:]...), nil
+		}
+		segmentEnd := i + 2 + int(binary.BigEndian.Uint16(content[i+2:i+4]))
+		if segmentEnd > len(content) {
+			return nil, errMalformedJpeg
+		}
+		if marker != 0xE1 {
+			res = append(res, content[i:segmentEnd]...)
+		}
+		i = segmentEnd
+	}
+	return nil, errMalformedJpeg
+}
+
+func stripPngExif(content []byte) ([]byte, error) {
+	res := make([]byte, 0, len(content))
+	res = append(res, pngSignature...)
+	i := len(pngSignature)
+	for i < len(content) {
+		if i+8 > len(content) {
+			return nil, errMalformedPng
+		}
+		// length, type, data and crc
+		chunkEnd := i + 12 + int(binary.BigEndian.Uint32(content[i:i+4]))
+		if chunkEnd > len(content) || chunkEnd < i {
+			return nil, errMalformedPng
+		}
+		if string(content[i+4:i+8]) != "eXIf" {
+			res = append(res, content[i:chunkEnd]...)
+		}
+		i = chunkEnd
+	}
+	return res, nil
+}
@@ -0,0 +1,154 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package imagehelper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+const orientationTag = 0x0112
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// Return the EXIF orientation (1 to 8) of a jpeg or png image, 1 (no transformation) when absent or malformed.
+func readOrientation(content []byte) int {
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(content, []byte{0xFF, 0xD8}):
+		tiff = jpegExif(content)
+	case bytes.HasPrefix(content, pngSignature):
+		tiff = pngExif(content)
+	}
+	if orientation := tiffOrientation(tiff); orientation >= 1 && orientation <= 8 {
+		return orientation
+	}
+	return 1
+}
+
+// content of the APP1 segment starting with the Exif header
+func jpegExif(content []byte) []byte {
+	i := 2
+	for i+4 <= len(content) && content[i] == 0xFF {
+		marker := content[i+1]
+		if marker == 0xDA {
+			break
+		}
+		segmentEnd := i + 2 + int(binary.BigEndian.Uint16(content[i+2:i+4]))
+		if segmentEnd > len(content) {
+			break
+		}
+		if segment := content[i+4 : segmentEnd]; marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+			return segment[len(exifHeader):]
+		}
+		i = segmentEnd
+	}
+	return nil
+}
+
+// content of the eXIf chunk
+func pngExif(content []byte) []byte {
+	i := len(pngSignature)
+	for i+8 <= len(content) {
+		chunkEnd := i + 12 + int(binary.BigEndian.Uint32(content[i:i+4]))
+		if chunkEnd > len(content) || chunkEnd < i {
+			break
+		}
+		if string(content[i+4:i+8]) == "eXIf" {
+			return content[i+8 : chunkEnd-4]
+		}
+		i = chunkEnd
+	}
+	return nil
+}
+
+// read the orientation entry of the first IFD, 0 when absent
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset : offset+2]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:entry+2]) == orientationTag {
+			// a SHORT value is stored at the start of the value field
+			return int(order.Uint16(tiff[entry+8 : entry+10]))
+		}
+	}
+	return 0
+}
+
+// apply the EXIF orientation to the pixels (orientation 1 returns img unchanged)
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	src := toRGBA(img)
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		// a quarter rotation swaps the dimensions
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = width-1-x, y
+			case 3: // rotated 180°
+				sx, sy = width-1-x, height-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, height-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90° counterclockwise, displayed after a clockwise rotation
+				sx, sy = y, height-1-x
+			case 7: // transversed
+				sx, sy = width-1-y, height-1-x
+			case 8: // rotated 90° clockwise, displayed after a counterclockwise rotation
+				sx, sy = width-1-y, x
+			}
+			srcOffset, dstOffset := src.PixOffset(sx, sy), dst.PixOffset(x, y)
+			copy(dst.Pix[dstOffset:dstOffset+4], src.Pix[srcOffset:srcOffset+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,91 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const forwardedForKey = "x-forwarded-for"
+
+var errNoPeer = errors.New("no peer information in context")
+
+// Return the ip of the caller read from the grpc peer.
+//
+// When the peer belongs to one of the trustedProxies, the "x-forwarded-for" metadata is read
+// from right to left and the first address which is not a trusted proxy is returned.
+func GetClientIp(ctx context.Context, trustedProxies ...netip.Prefix) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "", errNoPeer
+	}
+
+	addr, err := parseIp(p.Addr.String())
+	if err != nil {
+		return "", err
+	}
+	if !isTrusted(addr, trustedProxies) {
+		return addr.String(), nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	forwarded := md.Get(forwardedForKey)
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hops := strings.Split(forwarded[i], ",")
+		for j := len(hops) - 1; j >= 0; j-- {
+			hopAddr, err := parseIp(strings.TrimSpace(hops[j]))
+			if err != nil {
+				// a malformed entry can not be trusted, stop at the last valid hop
+				return addr.String(), nil
+			}
+			addr = hopAddr
+			if !isTrusted(addr, trustedProxies) {
+				return addr.String(), nil
+			}
+		}
+	}
+	return addr.String(), nil
+}
+
+func parseIp(value string) (netip.Addr, error) {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
+
+func isTrusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
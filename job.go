@@ -0,0 +1,286 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Name and path of the action added to the widgets with an async action.
+const JobStatusAction = "jobStatus"
+const JobStatusPath = "/jobStatus/:jobId"
+
+// Key of the job id in the data passed to the template of an async action.
+const JobIdKey = "JobId"
+
+const jobRetention = time.Hour
+
+const defaultMaxRunningJobs = 100
+
+var ErrJobNotFound = status.Error(codes.NotFound, "job not found")
+
+// Returned by an async action when the server already runs its maximum of jobs (see WithMaxRunningJobs).
+var ErrTooManyJobs = status.Error(codes.ResourceExhausted, "too many running jobs")
+
+// Returned by an async action called while the server shuts down.
+var ErrJobsStopped = status.Error(codes.Unavailable, "server is shutting down")
+
+var errRecoveredJobPanic = errors.New("recovered panic in job")
+
+type JobState string
+
+const (
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+)
+
+// State of a job returned in json by the JobStatusAction action, the result fields
+// are the values returned by the handler once it succeeds.
+type JobStatus struct {
+	Id           string   `json:"id"`
+	State        JobState `json:"state"`
+	Progress     float64  `json:"progress"`
+	Error        string   `json:"error,omitempty"`
+	Redirect     string   `json:"redirect,omitempty"`
+	TemplateName string   `json:"templateName,omitempty"`
+	Data         []byte   `json:"data,omitempty"` // base64 encoded in json
+}
+
+type job struct {
+	userId   uint64
+	status   JobStatus
+	finished time.Time
+}
+
+// background jobs of all the widgets, cancelled at shutdown
+type jobStore struct {
+	mutex   sync.Mutex
+	jobs    map[string]*job
+	slots   chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+	stopped bool
+}
+
+// Limit the number of async jobs running at the same time (default to 100, zero means no limit),
+// the async actions called beyond it fail fast with ErrTooManyJobs.
+func WithMaxRunningJobs(limit int) Option {
+	return func(o *serverOptions) {
+		o.maxRunningJobs = limit
+	}
+}
+
+func newJobStore(limit int, codec Codec) *jobStore {
+	var slots chan struct{}
+	if limit > 0 {
+		slots = make(chan struct{}, limit)
+	}
+	ctx, cancel := context.WithCancel(contextWithCodec(context.Background(), codec))
+	return &jobStore{jobs: map[string]*job{}, slots: slots, ctx: ctx, cancel: cancel}
+}
+
+// Register an action which starts handler in the background and immediately renders templateName
+// with the "JobId" entry, the page can then poll the JobStatusAction action (added to the widget,
+// with the "jobId" path parameter) to follow the progress (see SetJobProgress) and fetch the result.
+// Only the user who started a job can read its status, which is kept one hour after the end of the job.
+// The handler receives a copy of the call data (see CloneData) and its context is not cancelled
+// by the end of the call but by the shutdown of the server.
+func (w Widget) AddAsyncAction(actionName string, kind pb.MethodKind, path string, templateName string, handler ActionHandler, opts ...ActionOption) {
+	jobs := w.jobs
+	defaultLogger := w.logger
+	w.AddAction(actionName, kind, path, func(ctx context.Context, data Data) (string, string, []byte, error) {
+		// the job keeps the fields of the call logger
+		logger, ok := callLoggerFromContext(ctx)
+		if !ok {
+			logger = defaultLogger
+		}
+		jobId, err := jobs.start(logger, handler, data)
+		if err != nil {
+			return "", "", nil, err
+		}
+		resData, err := encodeData(Data{JobIdKey: jobId})
+		return "", templateName, resData, err
+	}, opts...)
+
+	// only the first async action adds it (ErrDuplicateAction for the next ones)
+	_ = w.tryAddAction(JobStatusAction, action{kind: pb.MethodKind_RAW, path: JobStatusPath, handler: jobs.statusHandler}, nil)
+}
+
+// Report the progress (between 0 and 1) of the job running with ctx, ignored outside of an async action.
+func SetJobProgress(ctx context.Context, progress float64) {
+	current, ok := ctx.Value(jobContextKey).(*jobRef)
+	if !ok {
+		return
+	}
+	current.store.mutex.Lock()
+	if j, ok := current.store.jobs[current.id]; ok {
+		j.status.Progress = progress
+	}
+	current.store.mutex.Unlock()
+}
+
+type jobRef struct {
+	store *jobStore
+	id    string
+}
+
+func (s *jobStore) start(logger *otelzap.Logger, handler ActionHandler, data Data) (string, error) {
+	if !acquireActionSlot(s.slots) {
+		return "", ErrTooManyJobs
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		releaseActionSlot(s.slots)
+		return "", err
+	}
+	jobId := hex.EncodeToString(idBytes)
+
+	// an invalid or missing id is handled as anonymous
+	userId, _ := GetCurrentUserId(data)
+	now := time.Now()
+	s.mutex.Lock()
+	if s.stopped {
+		s.mutex.Unlock()
+		releaseActionSlot(s.slots)
+		return "", ErrJobsStopped
+	}
+	// under the lock, so stop does not wait before all the jobs are counted
+	s.running.Add(1)
+	for id, j := range s.jobs {
+		if !j.finished.IsZero() && now.Sub(j.finished) > jobRetention {
+			delete(s.jobs, id)
+		}
+	}
+	s.jobs[jobId] = &job{userId: userId, status: JobStatus{Id: jobId, State: JobRunning}}
+	s.mutex.Unlock()
+
+	ctx := context.WithValue(s.ctx, loggerContextKey, logger)
+	ctx = context.WithValue(ctx, jobContextKey, &jobRef{store: s, id: jobId})
+	// the call keeps using its data once the job is started
+	go s.run(ctx, jobId, handler, CloneData(data))
+	return jobId, nil
+}
+
+func (s *jobStore) run(ctx context.Context, jobId string, handler ActionHandler, data Data) {
+	defer s.running.Done()
+	defer releaseActionSlot(s.slots)
+
+	redirect, templateName, resData, err := callJobHandler(ctx, handler, data)
+	if err != nil {
+		LoggerFromContext(ctx).Error("Job failed", zap.String("jobId", jobId), zap.Error(err))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	j, ok := s.jobs[jobId]
+	if !ok {
+		return
+	}
+	j.finished = time.Now()
+	if err != nil {
+		j.status.State = JobFailed
+		j.status.Error = internalErrorMsg
+		var widgetErr *WidgetError
+		if errors.As(err, &widgetErr) && widgetErr.UserMessage != "" {
+			j.status.Error = widgetErr.UserMessage
+		}
+		return
+	}
+	j.status.State = JobSucceeded
+	j.status.Progress = 1
+	j.status.Redirect = redirect
+	j.status.TemplateName = templateName
+	j.status.Data = resData
+}
+
+func callJobHandler(ctx context.Context, handler ActionHandler, data Data) (redirect string, templateName string, resData []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			LoggerFromContext(ctx).Error("Recovered panic in job", zap.Any("panic", r), zap.ByteString("stack", debug.Stack()))
+			err = errRecoveredJobPanic
+		}
+	}()
+	return handler(ctx, data)
+}
+
+func (s *jobStore) statusHandler(ctx context.Context, data Data) (string, string, []byte, error) {
+	jobId, err := GetPathString(data, "jobId")
+	if err != nil {
+		return "", "", nil, err
+	}
+	// an invalid or missing id is handled as anonymous
+	userId, _ := GetCurrentUserId(data)
+
+	s.mutex.Lock()
+	j, ok := s.jobs[jobId]
+	var jobStatus JobStatus
+	if ok {
+		jobStatus = j.status
+	}
+	s.mutex.Unlock()
+	if !ok || j.userId != userId {
+		return "", "", nil, ErrJobNotFound
+	}
+
+	resData, err := json.Marshal(jobStatus)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if err = SetResponseHeader(ctx, contentTypeName, "application/json"); err != nil {
+		return "", "", nil, err
+	}
+	return "", "", resData, nil
+}
+
+// cancel the jobs and wait for them to return (until ctx is done)
+func (s *jobStore) stop(ctx context.Context) error {
+	s.mutex.Lock()
+	s.stopped = true
+	s.mutex.Unlock()
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+)
+
+func TestJobStoreStop(t *testing.T) {
+	store := newJobStore(0, StdCodec{})
+	var finished atomic.Bool
+	_, err := store.start(otelzap.New(zap.NewNop()), func(ctx context.Context, data Data) (string, string, []byte, error) {
+		<-ctx.Done()
+		// like a job releasing its resources
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+		return "", "", nil, ctx.Err()
+	}, Data{})
+	if err != nil {
+		t.Fatalf("failed to start the job : %v", err)
+	}
+
+	if err = store.stop(context.Background()); err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	if !finished.Load() {
+		t.Error("stop returned before the end of the job")
+	}
+	if _, err = store.start(otelzap.New(zap.NewNop()), noopHandler, Data{}); err != ErrJobsStopped {
+		t.Errorf("got %v after stop, want %v", err, ErrJobsStopped)
+	}
+}
+
+func TestJobStoreStopTimeout(t *testing.T) {
+	store := newJobStore(0, StdCodec{})
+	release := make(chan struct{})
+	defer close(release)
+	_, err := store.start(otelzap.New(zap.NewNop()), func(ctx context.Context, data Data) (string, string, []byte, error) {
+		// ignore the cancellation
+		<-release
+		return "", "", nil, nil
+	}, Data{})
+	if err != nil {
+		t.Fatalf("failed to start the job : %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err = store.stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
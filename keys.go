@@ -0,0 +1,74 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Keys of the Data passed to handlers, filled by the frontend or by Process.
+const (
+	FormKey         = "formData"   // submitted form
+	FilesKey        = "Files"      // files sent with Process
+	FilePartsKey    = "FileParts"  // files sent with Upload (see GetFileParts)
+	CurrentUrlKey   = "CurrentUrl" // url of the current page
+	UserIdKey       = "Id"         // id of the connected user (absent or 0 when anonymous)
+	HistoryKey      = "History"    // visited urls, the most recent last
+	LocaleKey       = "Lang"       // locale of the user
+	SessionKey      = "Session"    // session values of the user (see GetSession)
+	FlashesKey      = "Flashes"    // flash messages to display (see GetFlashes)
+	PathDataPrefix  = "pathData/"  // followed by the name of a path parameter
+	QueryDataPrefix = "queryData/" // followed by the name of a query parameter
+)
+
+// Return the keys and prefixes (the entries ending with "/") of the Data filled by
+// the frontend and Process, handler returned data should not use them.
+func ReservedKeys() []string {
+	return append([]string(nil), reservedKeys...)
+}
+
+var reservedKeys = []string{
+	FormKey, FilesKey, FilePartsKey, CurrentUrlKey, UserIdKey, HistoryKey, LocaleKey, SessionKey, FlashesKey, PathDataPrefix, QueryDataPrefix,
+}
+
+func isReservedKey(key string) bool {
+	for _, reserved := range reservedKeys {
+		if key == reserved || (strings.HasSuffix(reserved, "/") && strings.HasPrefix(key, reserved)) {
+			return true
+		}
+	}
+	return false
+}
+
+// the template data are merged with the ones of the frontend, a reserved key would override them
+func checkReservedKeys(resData []byte) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(resData, &values); err != nil {
+		// not an object, nothing to collide
+		return nil
+	}
+	for key := range values {
+		if isReservedKey(key) {
+			return fmt.Errorf("%w : %s", errReservedKey, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Return the logger of the current call, tagged by Process with the widget name, the action name,
+// the request id (see RequestIdFromContext) and the trace id.
+// Outside of a call, the global otelzap logger is returned.
+func LoggerFromContext(ctx context.Context) otelzap.LoggerWithCtx {
+	logger, ok := callLoggerFromContext(ctx)
+	if !ok {
+		logger = otelzap.L()
+	}
+	return logger.Ctx(ctx)
+}
+
+// the tagged logger is built on first use (most calls do not log)
+type callLogger struct {
+	once        sync.Once
+	base        *otelzap.Logger
+	widgetName  string
+	actionName  string
+	requestId   string
+	spanContext trace.SpanContext
+	logger      *otelzap.Logger
+}
+
+func (l *callLogger) get() *otelzap.Logger {
+	l.once.Do(func() {
+		fields := []zap.Field{zap.String("widget", l.widgetName), zap.String("action", l.actionName), zap.String("requestId", l.requestId)}
+		if l.spanContext.HasTraceID() {
+			fields = append(fields, zap.String("traceId", l.spanContext.TraceID().String()))
+		}
+		l.logger = l.base.WithOptions(zap.Fields(fields...))
+	})
+	return l.logger
+}
+
+func contextWithLogger(ctx context.Context, logger *otelzap.Logger, widgetName string, actionName string) context.Context {
+	return context.WithValue(ctx, loggerContextKey, &callLogger{
+		base: logger, widgetName: widgetName, actionName: actionName,
+		requestId: RequestIdFromContext(ctx), spanContext: trace.SpanContextFromContext(ctx),
+	})
+}
+
+// the logger of a call (see contextWithLogger) or of a job
+func callLoggerFromContext(ctx context.Context) (*otelzap.Logger, bool) {
+	switch logger := ctx.Value(loggerContextKey).(type) {
+	case *callLogger:
+		return logger.get(), true
+	case *otelzap.Logger:
+		return logger, true
+	}
+	return nil, false
+}
@@ -0,0 +1,61 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// filter the entries before the core of the configured logger
+type levelFilterCore struct {
+	zapcore.Core
+	level zap.AtomicLevel
+}
+
+func (c levelFilterCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level) && c.Core.Enabled(level)
+}
+
+func (c levelFilterCore) With(fields []zapcore.Field) zapcore.Core {
+	return levelFilterCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c levelFilterCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
+
+// the level starts at debug to let the configured one decide
+func withAtomicLevel(logger *otelzap.Logger) (*otelzap.Logger, zap.AtomicLevel) {
+	level := zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return levelFilterCore{Core: core, level: level}
+	})), level
+}
+
+// Change the minimum level of the server logs at runtime (also possible with the "/loglevel" route
+// of WithObservabilityHTTP). The level can not go below the one of the logging configuration
+// (set it to debug in the file of LOG_CONFIG_PATH to allow switching to debug without a restart).
+func (s WidgetServer) SetLogLevel(level zapcore.Level) {
+	s.logLevel.SetLevel(level)
+}
@@ -0,0 +1,219 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.uber.org/zap"
+)
+
+const meterName = "github.com/dvaumoron/puzzlewidgetserver"
+
+const reasonPanic = "panic"
+const reasonError = "error"
+const reasonTimeout = "timeout"
+const reasonOverloaded = "overloaded"
+const reasonCanceled = "canceled"
+
+type errorLabels struct {
+	widget string
+	action string
+	reason string
+}
+
+type callLabels struct {
+	widget string
+	action string
+}
+
+type summaryStat struct {
+	count uint64
+	sum   float64
+}
+
+// in process copy of the counters, served in the prometheus text format (see WithObservabilityHTTP)
+type localMetrics struct {
+	mutex         sync.Mutex
+	errors        map[errorLabels]uint64
+	durations     map[callLabels]*summaryStat
+	requestSizes  map[callLabels]*summaryStat
+	responseSizes map[callLabels]*summaryStat
+}
+
+type processMetrics struct {
+	errors       instrument.Int64Counter
+	duration     instrument.Float64Histogram
+	requestSize  instrument.Int64Histogram
+	responseSize instrument.Int64Histogram
+	local        *localMetrics
+}
+
+func newProcessMetrics(logger *otelzap.Logger) processMetrics {
+	meter := global.Meter(meterName)
+
+	errorCounter, err := meter.Int64Counter(
+		"puzzlewidget.process.errors", instrument.WithDescription("Number of failed Process calls, by reason"),
+	)
+	if err != nil {
+		logger.Warn("Failed to create error counter", zap.Error(err))
+	}
+	durationHistogram, err := meter.Float64Histogram(
+		"puzzlewidget.process.duration", instrument.WithDescription("Duration of Process calls, in seconds"),
+	)
+	if err != nil {
+		logger.Warn("Failed to create duration histogram", zap.Error(err))
+	}
+	requestSizeHistogram, err := meter.Int64Histogram(
+		"puzzlewidget.process.request.size", instrument.WithDescription("Size of the data and files received by Process calls, in bytes"),
+	)
+	if err != nil {
+		logger.Warn("Failed to create request size histogram", zap.Error(err))
+	}
+	responseSizeHistogram, err := meter.Int64Histogram(
+		"puzzlewidget.process.response.size", instrument.WithDescription("Size of the data returned by Process calls, in bytes"),
+	)
+	if err != nil {
+		logger.Warn("Failed to create response size histogram", zap.Error(err))
+	}
+	return processMetrics{
+		errors: errorCounter, duration: durationHistogram, requestSize: requestSizeHistogram, responseSize: responseSizeHistogram,
+		local: &localMetrics{
+			errors: map[errorLabels]uint64{}, durations: map[callLabels]*summaryStat{},
+			requestSizes: map[callLabels]*summaryStat{}, responseSizes: map[callLabels]*summaryStat{},
+		},
+	}
+}
+
+func (m processMetrics) recordError(ctx context.Context, widgetName string, actionName string, reason string) {
+	if m.errors != nil {
+		m.errors.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("widget", widgetName), attribute.String("action", actionName), attribute.String("reason", reason),
+		))
+	}
+
+	m.local.mutex.Lock()
+	m.local.errors[errorLabels{widget: widgetName, action: actionName, reason: reason}]++
+	m.local.mutex.Unlock()
+}
+
+func (m processMetrics) recordDuration(ctx context.Context, widgetName string, actionName string, duration time.Duration) {
+	seconds := duration.Seconds()
+	if m.duration != nil {
+		m.duration.Record(ctx, seconds, metric.WithAttributes(attribute.String("widget", widgetName), attribute.String("action", actionName)))
+	}
+
+	m.local.observe(m.local.durations, callLabels{widget: widgetName, action: actionName}, seconds)
+}
+
+func (m processMetrics) recordRequestSize(ctx context.Context, widgetName string, actionName string, size int) {
+	if m.requestSize != nil {
+		m.requestSize.Record(ctx, int64(size), metric.WithAttributes(attribute.String("widget", widgetName), attribute.String("action", actionName)))
+	}
+	m.local.observe(m.local.requestSizes, callLabels{widget: widgetName, action: actionName}, float64(size))
+}
+
+func (m processMetrics) recordResponseSize(ctx context.Context, widgetName string, actionName string, size int) {
+	if m.responseSize != nil {
+		m.responseSize.Record(ctx, int64(size), metric.WithAttributes(attribute.String("widget", widgetName), attribute.String("action", actionName)))
+	}
+	m.local.observe(m.local.responseSizes, callLabels{widget: widgetName, action: actionName}, float64(size))
+}
+
+func (l *localMetrics) observe(stats map[callLabels]*summaryStat, labels callLabels, value float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	stat, ok := stats[labels]
+	if !ok {
+		stat = &summaryStat{}
+		stats[labels] = stat
+	}
+	stat.count++
+	stat.sum += value
+}
+
+func (m processMetrics) writePrometheus(w io.Writer) error {
+	m.local.mutex.Lock()
+	errorLines := make([]string, 0, len(m.local.errors))
+	for labels, count := range m.local.errors {
+		errorLines = append(errorLines, fmt.Sprintf(
+			"puzzlewidget_process_errors_total{widget=%s,action=%s,reason=%s} %d\n",
+			quoteLabel(labels.widget), quoteLabel(labels.action), quoteLabel(labels.reason), count,
+		))
+	}
+	durationLines := summaryLines("puzzlewidget_process_duration_seconds", m.local.durations)
+	requestSizeLines := summaryLines("puzzlewidget_process_request_size_bytes", m.local.requestSizes)
+	responseSizeLines := summaryLines("puzzlewidget_process_response_size_bytes", m.local.responseSizes)
+	m.local.mutex.Unlock()
+
+	if err := writeMetricFamily(w, "# HELP puzzlewidget_process_errors_total Number of failed Process calls, by reason\n# TYPE puzzlewidget_process_errors_total counter\n", errorLines); err != nil {
+		return err
+	}
+	if err := writeMetricFamily(w, "# HELP puzzlewidget_process_duration_seconds Duration of Process calls\n# TYPE puzzlewidget_process_duration_seconds summary\n", durationLines); err != nil {
+		return err
+	}
+	if err := writeMetricFamily(w, "# HELP puzzlewidget_process_request_size_bytes Size of the data and files received by Process calls\n# TYPE puzzlewidget_process_request_size_bytes summary\n", requestSizeLines); err != nil {
+		return err
+	}
+	return writeMetricFamily(w, "# HELP puzzlewidget_process_response_size_bytes Size of the data returned by Process calls\n# TYPE puzzlewidget_process_response_size_bytes summary\n", responseSizeLines)
+}
+
+// should be called with the lock held
+func summaryLines(name string, stats map[callLabels]*summaryStat) []string {
+	lines := make([]string, 0, 2*len(stats))
+	for labels, stat := range stats {
+		quotedLabels := fmt.Sprintf("widget=%s,action=%s", quoteLabel(labels.widget), quoteLabel(labels.action))
+		lines = append(lines,
+			fmt.Sprintf("%s_count{%s} %d\n", name, quotedLabels, stat.count),
+			fmt.Sprintf("%s_sum{%s} %g\n", name, quotedLabels, stat.sum),
+		)
+	}
+	return lines
+}
+
+func writeMetricFamily(w io.Writer, header string, lines []string) error {
+	sort.Strings(lines)
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var labelReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func quoteLabel(value string) string {
+	return "\"" + labelReplacer.Replace(value) + "\""
+}
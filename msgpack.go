@@ -0,0 +1,372 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var errMsgpackTruncated = errors.New("msgpack data truncated")
+var errMsgpackKey = errors.New("msgpack map key is not a string")
+var errMsgpackDepth = errors.New("msgpack data nesting too deep")
+
+// same nesting limit as encoding/json, one byte per level could otherwise exhaust the stack
+const maxMsgpackDepth = 10000
+
+// Codec using the MessagePack format, maps are decoded as Data and arrays as []any.
+// Values of other types than the ones produced by json.Unmarshal are encoded
+// through their json representation.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	return appendMsgpack(nil, v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v any) error {
+	decoder := msgpackDecoder{data: data}
+	decoded, err := decoder.decode()
+	if err != nil {
+		return err
+	}
+	if decoder.offset != len(data) {
+		return errTrailingData
+	}
+
+	switch target := v.(type) {
+	case *any:
+		*target = decoded
+		return nil
+	case *Data:
+		m, err := AsMap(decoded)
+		if err != nil {
+			return err
+		}
+		*target = m
+		return nil
+	}
+	// other targets are filled through json
+	jsonBytes, err := json.Marshal(decoded)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonBytes, v)
+}
+
+func appendMsgpack(buffer []byte, value any) ([]byte, error) {
+	switch casted := value.(type) {
+	case nil:
+		return append(buffer, 0xc0), nil
+	case bool:
+		if casted {
+			return append(buffer, 0xc3), nil
+		}
+		return append(buffer, 0xc2), nil
+	case int:
+		return appendMsgpackInt(buffer, int64(casted)), nil
+	case int8:
+		return appendMsgpackInt(buffer, int64(casted)), nil
+	case int16:
+		return appendMsgpackInt(buffer, int64(casted)), nil
+	case int32:
+		return appendMsgpackInt(buffer, int64(casted)), nil
+	case int64:
+		return appendMsgpackInt(buffer, casted), nil
+	case uint:
+		return appendMsgpackUint(buffer, uint64(casted)), nil
+	case uint8:
+		return appendMsgpackUint(buffer, uint64(casted)), nil
+	case uint16:
+		return appendMsgpackUint(buffer, uint64(casted)), nil
+	case uint32:
+		return appendMsgpackUint(buffer, uint64(casted)), nil
+	case uint64:
+		return appendMsgpackUint(buffer, casted), nil
+	case float32:
+		return binary.BigEndian.AppendUint32(append(buffer, 0xca), math.Float32bits(casted)), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(append(buffer, 0xcb), math.Float64bits(casted)), nil
+	case json.Number:
+		if i, err := casted.Int64(); err == nil {
+			return appendMsgpackInt(buffer, i), nil
+		}
+		if u, err := AsUint64(casted); err == nil {
+			return appendMsgpackUint(buffer, u), nil
+		}
+		f, err := casted.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendMsgpack(buffer, f)
+	case string:
+		return append(appendMsgpackLength(buffer, len(casted), 0xa0, 31, 0xd9, 0xda, 0xdb), casted...), nil
+	case []byte:
+		return append(appendMsgpackLength(buffer, len(casted), 0, -1, 0xc4, 0xc5, 0xc6), casted...), nil
+	case []any:
+		buffer = appendMsgpackLength(buffer, len(casted), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, elem := range casted {
+			var err error
+			if buffer, err = appendMsgpack(buffer, elem); err != nil {
+				return nil, err
+			}
+		}
+		return buffer, nil
+	case Data:
+		keys := make([]string, 0, len(casted))
+		for key := range casted {
+			keys = append(keys, key)
+		}
+		// sorted like encoding/json, for a stable output
+		sort.Strings(keys)
+		buffer = appendMsgpackLength(buffer, len(casted), 0x80, 15, 0, 0xde, 0xdf)
+		for _, key := range keys {
+			buffer, _ = appendMsgpack(buffer, key)
+			var err error
+			if buffer, err = appendMsgpack(buffer, casted[key]); err != nil {
+				return nil, err
+			}
+		}
+		return buffer, nil
+	}
+
+	// other types (structs, typed slices and maps, etc.) are converted with their json representation
+	jsonBytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var converted any
+	if err = (StdCodec{UseNumber: true}).Unmarshal(jsonBytes, &converted); err != nil {
+		return nil, err
+	}
+	return appendMsgpack(buffer, converted)
+}
+
+func appendMsgpackInt(buffer []byte, value int64) []byte {
+	switch {
+	case value >= 0:
+		return appendMsgpackUint(buffer, uint64(value))
+	case value >= -32:
+		return append(buffer, byte(value))
+	case value >= math.MinInt8:
+		return append(buffer, 0xd0, byte(value))
+	case value >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buffer, 0xd1), uint16(value))
+	case value >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buffer, 0xd2), uint32(value))
+	}
+	return binary.BigEndian.AppendUint64(append(buffer, 0xd3), uint64(value))
+}
+
+func appendMsgpackUint(buffer []byte, value uint64) []byte {
+	switch {
+	case value <= 0x7f:
+		return append(buffer, byte(value))
+	case value <= math.MaxUint8:
+		return append(buffer, 0xcc, byte(value))
+	case value <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buffer, 0xcd), uint16(value))
+	case value <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buffer, 0xce), uint32(value))
+	}
+	return binary.BigEndian.AppendUint64(append(buffer, 0xcf), value)
+}
+
+// fixMax is the maximum length of the fix format (-1 when there is none),
+// code8 is ignored when zero (arrays and maps have no 8 bits length format)
+func appendMsgpackLength(buffer []byte, length int, fixCode byte, fixMax int, code8 byte, code16 byte, code32 byte) []byte {
+	switch {
+	case length <= fixMax:
+		return append(buffer, fixCode|byte(length))
+	case code8 != 0 && length <= math.MaxUint8:
+		return append(buffer, code8, byte(length))
+	case length <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buffer, code16), uint16(length))
+	}
+	return binary.BigEndian.AppendUint32(append(buffer, code32), uint32(length))
+}
+
+type msgpackDecoder struct {
+	data   []byte
+	offset int
+	depth  int
+}
+
+func (d *msgpackDecoder) read(size int) ([]byte, error) {
+	if size < 0 || len(d.data)-d.offset < size {
+		return nil, errMsgpackTruncated
+	}
+	res := d.data[d.offset : d.offset+size]
+	d.offset += size
+	return res, nil
+}
+
+func (d *msgpackDecoder) readUint(size int) (uint64, error) {
+	b, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (d *msgpackDecoder) decode() (any, error) {
+	codeBytes, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	code := codeBytes[0]
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xe0 == 0xa0:
+		return d.decodeString(int(code & 0x1f))
+	case code&0xf0 == 0x90:
+		return d.decodeArray(int(code & 0x0f))
+	case code&0xf0 == 0x80:
+		return d.decodeMap(int(code & 0x0f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		length, err := d.readUint(1 << (code - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.read(int(length))
+		return append([]byte(nil), b...), err
+	case 0xca:
+		bits, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case 0xcb:
+		bits, err := d.readUint(8)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		value, err := d.readUint(1 << (code - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if value <= math.MaxInt64 {
+			return int64(value), nil
+		}
+		return value, nil
+	case 0xd0:
+		value, err := d.readUint(1)
+		return int64(int8(value)), err
+	case 0xd1:
+		value, err := d.readUint(2)
+		return int64(int16(value)), err
+	case 0xd2:
+		value, err := d.readUint(4)
+		return int64(int32(value)), err
+	case 0xd3:
+		value, err := d.readUint(8)
+		return int64(value), err
+	case 0xd9, 0xda, 0xdb:
+		length, err := d.readUint(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(length))
+	case 0xdc, 0xdd:
+		length, err := d.readUint(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(length))
+	case 0xde, 0xdf:
+		length, err := d.readUint(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(length))
+	}
+	return nil, fmt.Errorf("unsupported msgpack type 0x%x", code)
+}
+
+func (d *msgpackDecoder) decodeString(length int) (any, error) {
+	b, err := d.read(length)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) decodeArray(length int) (any, error) {
+	if length > len(d.data)-d.offset {
+		// each element takes at least one byte
+		return nil, errMsgpackTruncated
+	}
+	if d.depth++; d.depth > maxMsgpackDepth {
+		return nil, errMsgpackDepth
+	}
+	defer func() { d.depth-- }()
+	res := make([]any, 0, length)
+	for i := 0; i < length; i++ {
+		elem, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, elem)
+	}
+	return res, nil
+}
+
+func (d *msgpackDecoder) decodeMap(length int) (any, error) {
+	if 2*length > len(d.data)-d.offset {
+		return nil, errMsgpackTruncated
+	}
+	if d.depth++; d.depth > maxMsgpackDepth {
+		return nil, errMsgpackDepth
+	}
+	defer func() { d.depth-- }()
+	res := make(Data, length)
+	for i := 0; i < length; i++ {
+		key, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		keyString, ok := key.(string)
+		if !ok {
+			return nil, errMsgpackKey
+		}
+		if res[keyString], err = d.decode(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
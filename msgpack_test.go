@@ -0,0 +1,215 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{name: "nil", value: nil, want: nil},
+		{name: "true", value: true, want: true},
+		{name: "false", value: false, want: false},
+		{name: "positive fixint", value: 127, want: int64(127)},
+		{name: "negative fixint", value: -32, want: int64(-32)},
+		{name: "uint8", value: uint8(200), want: int64(200)},
+		{name: "int16", value: int16(-300), want: int64(-300)},
+		{name: "int32", value: int32(-70000), want: int64(-70000)},
+		{name: "min int64", value: int64(math.MinInt64), want: int64(math.MinInt64)},
+		{name: "max int64", value: int64(math.MaxInt64), want: int64(math.MaxInt64)},
+		{name: "max uint64", value: uint64(math.MaxUint64), want: uint64(math.MaxUint64)},
+		{name: "float32", value: float32(1.5), want: 1.5},
+		{name: "float64", value: 3.25, want: 3.25},
+		{name: "json number", value: json.Number("12"), want: int64(12)},
+		{name: "json number float", value: json.Number("1.5"), want: 1.5},
+		{name: "fixstr", value: strings.Repeat("a", 31), want: strings.Repeat("a", 31)},
+		{name: "str8", value: strings.Repeat("b", 200), want: strings.Repeat("b", 200)},
+		{name: "str16", value: strings.Repeat("c", 1000), want: strings.Repeat("c", 1000)},
+		{name: "str32", value: strings.Repeat("d", 70000), want: strings.Repeat("d", 70000)},
+		{name: "bin", value: []byte{0, 1, 2}, want: []byte{0, 1, 2}},
+		{name: "fixarray", value: []any{1, "a", nil}, want: []any{int64(1), "a", nil}},
+		{name: "array16", value: make([]any, 20), want: make([]any, 20)},
+		{
+			name: "nested map", value: Data{"a": Data{"b": []any{true, 2.5}}, "c": "d"},
+			want: Data{"a": Data{"b": []any{true, 2.5}}, "c": "d"},
+		},
+		{name: "struct", value: struct{ Name string }{Name: "Ada"}, want: Data{"Name": "Ada"}},
+		{name: "typed slice", value: []string{"a", "b"}, want: []any{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := MsgpackCodec{}.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("failed to marshal : %v", err)
+			}
+			var decoded any
+			if err = (MsgpackCodec{}).Unmarshal(encoded, &decoded); err != nil {
+				t.Fatalf("failed to unmarshal : %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.want) {
+				t.Errorf("got %#v, want %#v", decoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestMsgpackUnmarshalTargets(t *testing.T) {
+	encoded, err := MsgpackCodec{}.Marshal(Data{"name": "Ada", "age": 36})
+	if err != nil {
+		t.Fatalf("failed to marshal : %v", err)
+	}
+
+	var data Data
+	if err = (MsgpackCodec{}).Unmarshal(encoded, &data); err != nil {
+		t.Fatalf("failed to unmarshal in Data : %v", err)
+	}
+	if want := (Data{"name": "Ada", "age": int64(36)}); !reflect.DeepEqual(data, want) {
+		t.Errorf("got %v, want %v", data, want)
+	}
+
+	var person struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	if err = (MsgpackCodec{}).Unmarshal(encoded, &person); err != nil {
+		t.Fatalf("failed to unmarshal in a struct : %v", err)
+	}
+	if person.Name != "Ada" || person.Age != 36 {
+		t.Errorf("got %+v", person)
+	}
+}
+
+func TestMsgpackUnmarshalErrors(t *testing.T) {
+	deep := append(bytes.Repeat([]byte{0x91}, maxMsgpackDepth+1), 0xc0)
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "empty", data: nil, wantErr: errMsgpackTruncated},
+		{name: "truncated string", data: []byte{0xa3, 'a'}, wantErr: errMsgpackTruncated},
+		{name: "truncated array", data: []byte{0x93, 0x01}, wantErr: errMsgpackTruncated},
+		{name: "huge array length", data: []byte{0xdd, 0xff, 0xff, 0xff, 0xff}, wantErr: errMsgpackTruncated},
+		{name: "non string key", data: []byte{0x81, 0x01, 0x02}, wantErr: errMsgpackKey},
+		{name: "trailing data", data: []byte{0xc0, 0xc0}, wantErr: errTrailingData},
+		{name: "too deep arrays", data: deep, wantErr: errMsgpackDepth},
+		{name: "too deep maps", data: append(bytes.Repeat([]byte{0x81, 0xa1, 'k'}, maxMsgpackDepth+1), 0xc0), wantErr: errMsgpackDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded any
+			if err := (MsgpackCodec{}).Unmarshal(tt.data, &decoded); err != tt.wantErr {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	var decoded any
+	if err := (MsgpackCodec{}).Unmarshal(deep[1:], &decoded); err != nil {
+		t.Errorf("unexpected error at the depth limit : %v", err)
+	}
+}
+
+func dataActionHandler(ctx context.Context, data Data) (string, string, Data, error) {
+	return "", "view", Data{"name": "Ada"}, nil
+}
+
+func TestMarshalData(t *testing.T) {
+	jsonData := []byte(`{"name":"Ada"}`)
+	msgpackData, err := MsgpackCodec{}.Marshal(Data{"name": "Ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		options      []Option
+		requestCodec Codec
+		accept       string
+		want         []byte
+		wantEncoding []string
+	}{
+		{name: "default", want: jsonData},
+		{name: "server codec", options: []Option{WithCodec(MsgpackCodec{})}, requestCodec: MsgpackCodec{}, want: msgpackData},
+		{
+			name: "negotiated", options: []Option{WithDataEncoding("msgpack", MsgpackCodec{})}, accept: "msgpack",
+			want: msgpackData, wantEncoding: []string{"msgpack"},
+		},
+		{name: "not negotiated", options: []Option{WithDataEncoding("msgpack", MsgpackCodec{})}, accept: "cbor", want: jsonData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.options...)
+			s.CreateWidget("test").AddDataAction("view", pb.MethodKind_GET, "/view", dataActionHandler)
+
+			ctx := context.Background()
+			if tt.accept != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(acceptDataHeader, tt.accept))
+			}
+			if tt.requestCodec == nil {
+				tt.requestCodec = StdCodec{}
+			}
+			dataBytes, err := tt.requestCodec.Marshal(Data{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			stream := &testTransportStream{header: metadata.MD{}}
+			response, err := s.Handler().Process(grpc.NewContextWithServerTransportStream(ctx, stream), &pb.ProcessRequest{
+				WidgetName: "test", ActionName: "view", Files: map[string][]byte{dataKey: dataBytes},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if !bytes.Equal(response.Data, tt.want) {
+				t.Errorf("got data %q, want %q", response.Data, tt.want)
+			}
+			if got := stream.header.Get("puzzle-data-encoding"); !reflect.DeepEqual(got, tt.wantEncoding) {
+				t.Errorf("got encoding %v, want %v", got, tt.wantEncoding)
+			}
+		})
+	}
+}
+
+func TestMarshalDataOutsideOfCalls(t *testing.T) {
+	encoded, err := MarshalData(context.Background(), Data{"name": "Ada"})
+	if err != nil || string(encoded) != `{"name":"Ada"}` {
+		t.Errorf("got %q (%v) without server context", encoded, err)
+	}
+
+	store := newJobStore(0, MsgpackCodec{})
+	want, _ := MsgpackCodec{}.Marshal(Data{"name": "Ada"})
+	if encoded, err = MarshalData(store.ctx, Data{"name": "Ada"}); err != nil || !bytes.Equal(encoded, want) {
+		t.Errorf("got %q (%v) in a job context, want %q", encoded, err, want)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import "strings"
+
+// Return the value at path in nested maps ("formData/address/city" read the "city" entry of the "address" map
+// of the "formData" map), nil when a level is missing or is not a map.
+// Keys containing a "/" (like "pathData/id") are found too, a whole key is tried before splitting it.
+func GetPathValue(data Data, path string) any {
+	if value, ok := data[path]; ok {
+		return value
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '/' {
+			continue
+		}
+		if nested, ok := data[path[:i]].(Data); ok {
+			if value := GetPathValue(nested, path[i+1:]); value != nil {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+// Return the string at key (a path, see GetPathValue), or defaultValue when it is absent, blank or not a string.
+func GetStringOr(data Data, key string, defaultValue string) string {
+	value, ok := GetPathValue(data, key).(string)
+	if !ok || strings.TrimSpace(value) == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// Return the value at key (a path, see GetPathValue) converted with AsUint64,
+// or defaultValue when it is absent, blank or invalid.
+func GetUint64Or(data Data, key string, defaultValue uint64) uint64 {
+	value := GetPathValue(data, key)
+	if !isPresent(value) {
+		return defaultValue
+	}
+	res, err := AsUint64(value)
+	if err != nil {
+		return defaultValue
+	}
+	return res
+}
+
+// Same as GetUint64Or with AsInt64.
+func GetInt64Or(data Data, key string, defaultValue int64) int64 {
+	value := GetPathValue(data, key)
+	if !isPresent(value) {
+		return defaultValue
+	}
+	res, err := AsInt64(value)
+	if err != nil {
+		return defaultValue
+	}
+	return res
+}
+
+// Same as GetUint64Or with AsBool.
+func GetBoolOr(data Data, key string, defaultValue bool) bool {
+	value := GetPathValue(data, key)
+	if !isPresent(value) {
+		return defaultValue
+	}
+	res, err := AsBool(value)
+	if err != nil {
+		return defaultValue
+	}
+	return res
+}
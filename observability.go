@@ -0,0 +1,72 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+
+	"go.uber.org/zap"
+)
+
+// Serve on addr an http endpoint exposing the metrics of the server in the prometheus
+// text format ("/metrics"), the registered widgets as a Spec in json ("/widgets"),
+// the log level (read with GET and changed with PUT, like {"level":"debug"}, on "/loglevel")
+// and the net/http/pprof handlers ("/debug/pprof/").
+// The endpoint is started by Start and stopped by Shutdown.
+func WithObservabilityHTTP(addr string) Option {
+	return func(o *serverOptions) {
+		o.observabilityAddr = addr
+	}
+}
+
+func newObservabilityServer(addr string, metrics processMetrics, reg *registry, logLevel zap.AtomicLevel) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.writePrometheus(w)
+	})
+	mux.HandleFunc("/widgets", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buildSpec(reg.widgetInfos()))
+	})
+	mux.Handle("/loglevel", logLevel)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return &http.Server{Addr: addr, Handler: mux}
+}
+
+func (s WidgetServer) startObservability() {
+	if s.observability == nil {
+		return
+	}
+	go func() {
+		ctx := context.Background()
+		s.logger.InfoContext(ctx, "Observability endpoint listening", zap.String("address", s.observability.Addr))
+		if err := s.observability.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.ErrorContext(ctx, "Failed to serve observability endpoint", zap.Error(err))
+		}
+	}()
+}
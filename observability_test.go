@@ -0,0 +1,101 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+// reserve a local address (released before returning, to be bound by the server)
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen : %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func getMetrics(addr string) (string, error) {
+	response, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	return string(body), err
+}
+
+func TestObservabilityMetrics(t *testing.T) {
+	addr := freeAddr(t)
+	s := newTestServer(t, WithObservabilityHTTP(addr), WithShutdownTimeout(time.Second))
+	s.CreateWidget("test").AddAction("fail", pb.MethodKind_GET, "/fail", failingHandler)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen : %v", err)
+	}
+	s.listener = listener
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.StartWithContext(ctx)
+	}()
+
+	invoke(context.Background(), s, "test", "fail", Data{})
+
+	var body string
+	for i := 0; i < 50; i++ {
+		if body, err = getMetrics(addr); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		cancel()
+		t.Fatalf("metrics not served : %v", err)
+	}
+	want := `puzzlewidget_process_errors_total{widget="test",action="fail",reason="error"} 1`
+	if !strings.Contains(body, want) {
+		t.Errorf("metrics miss %q, got :\n%s", want, body)
+	}
+
+	cancel()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("unexpected error on stop : %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not stopped")
+	}
+	if _, err = getMetrics(addr); err == nil {
+		t.Error("metrics still served after the stop")
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+)
+
+// PanicHook receive the value and the stack of a panic recovered in an handler (to report it to an external tool).
+type PanicHook = func(ctx context.Context, recovered any, stack []byte)
+
+type serverOptions struct {
+	grpcOptions          []grpc.ServerOption
+	validateResponse     bool
+	panicCode            codes.Code
+	maxResponseBytes     int
+	truncateResponse     bool
+	flags                FlagEvaluator
+	userIdInContext      bool
+	processTimeout       time.Duration
+	catalog              MessageCatalog
+	localeKey            string
+	submissions          SubmissionStore
+	trailingSlash        TrailingSlashMode
+	maxDataDepth         int
+	events               EventPublisher
+	errorReference       bool
+	observabilityAddr    string
+	requiredFields       []string
+	panicHook            PanicHook
+	shutdownTimeout      time.Duration
+	onDuplicate          DuplicatePolicy
+	maxFileSize          int64
+	csrfSecret           []byte
+	loginUrl             string
+	permissions          PermissionChecker
+	actionSlots          chan struct{}
+	heavyWorkers         int
+	healthCheckInterval  time.Duration
+	reflection           bool
+	certFile             string
+	keyFile              string
+	redactedKeys         []string
+	audit                AuditSink
+	codec                Codec
+	dataEncodings        []namedCodec
+	compressionThreshold int
+	maxRunningJobs       int
+	maxUploadSize        int64
+	maxUploadParts       int
+}
+
+func defaultOptions() serverOptions {
+	return serverOptions{
+		panicCode: codes.Internal, submissions: NewMemorySubmissionStore(), trailingSlash: TrailingSlashStrict,
+		shutdownTimeout: defaultShutdownTimeout, codec: StdCodec{}, maxRunningJobs: defaultMaxRunningJobs,
+		maxUploadSize: defaultMaxUploadSize, maxUploadParts: defaultMaxUploadParts, localeKey: LocaleKey,
+	}
+}
+
+// Option configure a WidgetServer created with MakeWithOptions.
+type Option func(*serverOptions)
+
+// Pass options to the underlying grpc server.
+func WithGRPCOptions(opts ...grpc.ServerOption) Option {
+	return func(o *serverOptions) {
+		o.grpcOptions = append(o.grpcOptions, opts...)
+	}
+}
+
+// Maximum size in bytes of a received message (default to 4MB in grpc), to raise for large uploads through Process.
+func WithMaxRecvMsgSize(size int) Option {
+	return WithGRPCOptions(grpc.MaxRecvMsgSize(size))
+}
+
+// Maximum size in bytes of a sent message (default to no limit in grpc).
+func WithMaxSendMsgSize(size int) Option {
+	return WithGRPCOptions(grpc.MaxSendMsgSize(size))
+}
+
+// Configure the keepalive pings and connection ages of the server, and the pings accepted from the clients.
+func WithKeepaliveParams(params keepalive.ServerParameters, policy keepalive.EnforcementPolicy) Option {
+	return WithGRPCOptions(grpc.KeepaliveParams(params), grpc.KeepaliveEnforcementPolicy(policy))
+}
+
+// Serve with TLS using the PEM encoded certificate and key files (loaded by MakeWithOptions, a failure is fatal).
+func WithTLSFromFiles(certFile string, keyFile string) Option {
+	return func(o *serverOptions) {
+		o.certFile = certFile
+		o.keyFile = keyFile
+	}
+}
+
+// Check handler returned values against the kind of the action (intended for development) :
+// templated actions must return json data without reserved keys (see ReservedKeys)
+// and RAW actions must not return a templateName.
+func WithResponseValidation() Option {
+	return func(o *serverOptions) {
+		o.validateResponse = true
+	}
+}
+
+// Call hook after logging each panic recovered in an handler.
+func WithPanicHook(hook PanicHook) Option {
+	return func(o *serverOptions) {
+		o.panicHook = hook
+	}
+}
+
+// Status code returned when a panic is recovered in an handler (default to codes.Internal).
+func WithPanicStatusCode(code codes.Code) Option {
+	return func(o *serverOptions) {
+		o.panicCode = code
+	}
+}
+
+// Limit the size of the data returned by handlers (zero means no limit).
+// Oversized responses are rejected with codes.ResourceExhausted, unless truncate is true,
+// in this case RAW responses are truncated with a logged warning
+// (templated responses are always rejected because truncated json would be unusable).
+func WithMaxResponseBytes(limit int, truncate bool) Option {
+	return func(o *serverOptions) {
+		o.maxResponseBytes = limit
+		o.truncateResponse = truncate
+	}
+}
+
+// Maximum duration of an handler call (zero means no limit), the handler context is cancelled after it
+// and the handler must then stop using its data (see ActionTimeout).
+func WithProcessTimeout(timeout time.Duration) Option {
+	return func(o *serverOptions) {
+		o.processTimeout = timeout
+	}
+}
+
+// Reject with codes.InvalidArgument the calls whose data have more than limit levels
+// of nested maps or slices (zero means no limit).
+func WithMaxDataDepth(limit int) Option {
+	return func(o *serverOptions) {
+		o.maxDataDepth = limit
+	}
+}
+
+// Reject with codes.InvalidArgument the calls whose data miss one of the keys
+// (context injected by the frontend like a tenant or site id).
+func WithRequiredFields(keys ...string) Option {
+	return func(o *serverOptions) {
+		o.requiredFields = append(o.requiredFields, keys...)
+	}
+}
+
+// Choose what happens when an action is registered twice on the same widget (see DuplicatePolicy).
+func WithDuplicateActionPolicy(policy DuplicatePolicy) Option {
+	return func(o *serverOptions) {
+		o.onDuplicate = policy
+	}
+}
+
+// Reject with ErrFileTooLarge the calls with a file (Files entry or uploaded part)
+// bigger than limit bytes (zero means no limit), see MaxFileSize to override it by action.
+func WithMaxFileSize(limit int64) Option {
+	return func(o *serverOptions) {
+		o.maxFileSize = limit
+	}
+}
+
+// Register the grpc reflection service, to explore the server with tools like grpcurl (intended for development).
+func WithReflection() Option {
+	return func(o *serverOptions) {
+		o.reflection = true
+	}
+}
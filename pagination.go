@@ -0,0 +1,177 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+var errInvalidCursor = errors.New("cursor is not valid")
+
+// Like InitPagination with the values needed to render a complete pager in the template :
+// "PageNumber", "PageSize", "PageSizes" (the choices to offer), "TotalPages", "IsFirstPage", "IsLastPage"
+// and "Pages", the page numbers to display with windowSize pages around the current one,
+// always the first and last ones, and 0 in place of the skipped pages (like 1 0 4 5 6 0 20).
+func InitPaginationWindow(data Data, filter string, pageNumber uint64, pageSize uint64, total uint64, windowSize uint64, pageSizes []uint64) {
+	InitPagination(data, filter, pageNumber, pageNumber*pageSize, total)
+
+	var totalPages uint64
+	if pageSize != 0 {
+		totalPages = (total + pageSize - 1) / pageSize
+	}
+	if totalPages == 0 {
+		// an empty list still displays its first page
+		totalPages = 1
+	}
+	data["PageNumber"] = pageNumber
+	data["PageSize"] = pageSize
+	data["PageSizes"] = pageSizes
+	data["TotalPages"] = totalPages
+	data["IsFirstPage"] = pageNumber <= 1
+	data["IsLastPage"] = pageNumber >= totalPages
+	data["Pages"] = pageWindow(pageNumber, totalPages, windowSize)
+}
+
+func pageWindow(pageNumber uint64, totalPages uint64, windowSize uint64) []uint64 {
+	// a page beyond the last one displays the end of the list
+	if pageNumber > totalPages {
+		pageNumber = totalPages
+	}
+	before := windowSize / 2
+	start := uint64(1)
+	if pageNumber > before+1 {
+		start = pageNumber - before
+	}
+	end := start + windowSize - 1
+	if windowSize == 0 {
+		end = start
+	}
+	if end > totalPages {
+		end = totalPages
+		if windowSize <= end {
+			start = end - windowSize + 1
+		} else {
+			start = 1
+		}
+	}
+
+	pages := make([]uint64, 0, windowSize+4)
+	if start > 1 {
+		pages = append(pages, 1)
+		if start == 3 {
+			// an ellipsis would hide a single page
+			pages = append(pages, 2)
+		} else if start > 3 {
+			pages = append(pages, 0)
+		}
+	}
+	for page := start; page <= end; page++ {
+		pages = append(pages, page)
+	}
+	if end < totalPages {
+		if end == totalPages-2 {
+			pages = append(pages, totalPages-1)
+		} else if end < totalPages-2 {
+			pages = append(pages, 0)
+		}
+		pages = append(pages, totalPages)
+	}
+	return pages
+}
+
+func GetCursorPaginationNames() []string {
+	return []string{"cursor", "pageSize", "filter"}
+}
+
+// Like GetPagination for a cursor based pagination : return the position (decoded from the opaque "cursor"
+// query parameter, empty for the first page), the page size (clamped like in GetPagination) and the filter.
+func GetCursorPagination(defaultPageSize uint64, data Data) (string, uint64, string, error) {
+	pageSize := getPageSize(defaultPageSize, defaultMaxPageSize(defaultPageSize), data)
+	filter, _ := GetQueryString(data, "filter")
+
+	cursor, _ := GetQueryString(data, "cursor")
+	position, err := DecodeCursor(cursor)
+	if err != nil {
+		return "", 0, "", err
+	}
+	return position, pageSize, filter, nil
+}
+
+// Place in data the opaque cursors of the next and previous pages (from the positions,
+// like the last and first ids of the page, omitted when empty) for the template.
+func InitCursorPagination(data Data, filter string, nextPosition string, previousPosition string) {
+	data["Filter"] = filter
+	if previousPosition != "" {
+		data["PreviousCursor"] = EncodeCursor(previousPosition)
+	}
+	if nextPosition != "" {
+		data["NextCursor"] = EncodeCursor(nextPosition)
+	}
+}
+
+// Make an opaque cursor (url safe base64) from a position.
+func EncodeCursor(position string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(position))
+}
+
+func DecodeCursor(cursor string) (string, error) {
+	position, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errInvalidCursor
+	}
+	return string(position), nil
+}
+
+const sortAscending = "asc"
+const sortDescending = "desc"
+
+// Sort of a list, By is a column name.
+type Sort struct {
+	By         string
+	Descending bool
+}
+
+func GetSortNames() []string {
+	return []string{"sortBy", "sortOrder"}
+}
+
+// Read the "sortBy" and "sortOrder" ("asc" or "desc") query parameters, defaultSort is returned
+// when the column is missing or not one of the allowed ones (so it can be used safely in a query).
+func GetSort(data Data, allowed []string, defaultSort Sort) Sort {
+	by, _ := GetQueryString(data, "sortBy")
+	if !contains(allowed, by) {
+		return defaultSort
+	}
+	order, _ := GetQueryString(data, "sortOrder")
+	return Sort{By: by, Descending: order == sortDescending}
+}
+
+// Place the sort in data ("SortBy" and "SortOrder") for the template, to build the headers links.
+func InitSort(data Data, sort Sort) {
+	data["SortBy"] = sort.By
+	data["SortOrder"] = sortOrderName(sort.Descending)
+}
+
+func sortOrderName(descending bool) string {
+	if descending {
+		return sortDescending
+	}
+	return sortAscending
+}
@@ -0,0 +1,80 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetCursorPagination(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultPageSize uint64
+		data            Data
+		wantPosition    string
+		wantPageSize    uint64
+	}{
+		{name: "first page", defaultPageSize: 20, data: Data{}, wantPageSize: 20},
+		{
+			name: "next page", defaultPageSize: 20,
+			data:         Data{QueryDataPrefix + "cursor": EncodeCursor("42"), QueryDataPrefix + "pageSize": "50"},
+			wantPosition: "42", wantPageSize: 50,
+		},
+		{name: "huge page size", defaultPageSize: 20, data: Data{QueryDataPrefix + "pageSize": "1000000000"}, wantPageSize: DefaultMaxPageSize},
+		{name: "large default", defaultPageSize: 5000, data: Data{QueryDataPrefix + "pageSize": "1000000000"}, wantPageSize: 5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			position, pageSize, _, err := GetCursorPagination(tt.defaultPageSize, tt.data)
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if position != tt.wantPosition || pageSize != tt.wantPageSize {
+				t.Errorf("got (%q, %d), want (%q, %d)", position, pageSize, tt.wantPosition, tt.wantPageSize)
+			}
+		})
+	}
+}
+
+func TestPageWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		pageNumber uint64
+		totalPages uint64
+		windowSize uint64
+		want       []uint64
+	}{
+		{name: "single page", pageNumber: 1, totalPages: 1, windowSize: 5, want: []uint64{1}},
+		{name: "all pages", pageNumber: 2, totalPages: 5, windowSize: 5, want: []uint64{1, 2, 3, 4, 5}},
+		{name: "middle", pageNumber: 10, totalPages: 20, windowSize: 5, want: []uint64{1, 0, 8, 9, 10, 11, 12, 0, 20}},
+		{name: "no ellipsis for one page", pageNumber: 4, totalPages: 20, windowSize: 3, want: []uint64{1, 2, 3, 4, 5, 0, 20}},
+		{name: "near the end", pageNumber: 17, totalPages: 20, windowSize: 3, want: []uint64{1, 0, 16, 17, 18, 19, 20}},
+		{name: "empty window", pageNumber: 3, totalPages: 10, windowSize: 0, want: []uint64{1, 2, 3, 0, 10}},
+		{name: "beyond the last page", pageNumber: 30, totalPages: 10, windowSize: 3, want: []uint64{1, 0, 8, 9, 10}},
+		{name: "beyond the last page with empty window", pageNumber: 30, totalPages: 10, windowSize: 0, want: []uint64{1, 0, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pageWindow(tt.pageNumber, tt.totalPages, tt.windowSize); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
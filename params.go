@@ -0,0 +1,74 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errMissingPathParam = errors.New("missing path parameter")
+
+// Return the value of the path parameter name (":name" in the action path, "pathData/name" in data),
+// unlike query parameters a path parameter is always expected, so its absence is an error.
+func GetPathString(data Data, name string) (string, error) {
+	value, ok := data[PathDataPrefix+name]
+	if !ok {
+		return "", fmt.Errorf("%w : %s", errMissingPathParam, name)
+	}
+	return AsString(value)
+}
+
+func GetPathUint64(data Data, name string) (uint64, error) {
+	value, err := GetPathString(data, name)
+	if err != nil {
+		return 0, err
+	}
+	return AsUint64(value)
+}
+
+func GetPathInt64(data Data, name string) (int64, error) {
+	value, err := GetPathString(data, name)
+	if err != nil {
+		return 0, err
+	}
+	return AsInt64(value)
+}
+
+// Return the value of the query parameter name ("queryData/name" in data, see AddActionWithQuery),
+// an absent parameter gives the zero value without error.
+func GetQueryString(data Data, name string) (string, error) {
+	return AsString(data[QueryDataPrefix+name])
+}
+
+func GetQueryUint64(data Data, name string) (uint64, error) {
+	return AsUint64(data[QueryDataPrefix+name])
+}
+
+func GetQueryInt64(data Data, name string) (int64, error) {
+	return AsInt64(data[QueryDataPrefix+name])
+}
+
+func GetQueryFloat64(data Data, name string) (float64, error) {
+	return AsFloat64(data[QueryDataPrefix+name])
+}
+
+func GetQueryBool(data Data, name string) (bool, error) {
+	return AsBool(data[QueryDataPrefix+name])
+}
@@ -0,0 +1,68 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidPath = errors.New("invalid action path")
+
+// Return the names of the parameters of a gin style path ("/view/:id/*rest" gives ["id", "rest"]),
+// the handler receive their values in data as "pathData/id" and "pathData/rest".
+//
+// The returned error wraps ErrInvalidPath when the path is empty or does not start with "/",
+// when a parameter has no name, is not a whole segment or is duplicated, or when a catch-all
+// parameter ("*name") is not the last segment.
+func ParsePathParams(path string) ([]string, error) {
+	if path == "" || path[0] != '/' {
+		return nil, fmt.Errorf("%w : %q must start with /", ErrInvalidPath, path)
+	}
+
+	var names []string
+	segments := strings.Split(path[1:], "/")
+	lastIndex := len(segments) - 1
+	for index, segment := range segments {
+		wildcardIndex := strings.IndexAny(segment, ":*")
+		if wildcardIndex == -1 {
+			continue
+		}
+		if wildcardIndex != 0 {
+			return nil, fmt.Errorf("%w : %q has a parameter not starting its segment", ErrInvalidPath, path)
+		}
+
+		name := segment[1:]
+		if name == "" {
+			return nil, fmt.Errorf("%w : %q has an unnamed parameter", ErrInvalidPath, path)
+		}
+		if strings.ContainsAny(name, ":*") {
+			return nil, fmt.Errorf("%w : %q has several parameters in one segment", ErrInvalidPath, path)
+		}
+		if segment[0] == '*' && index != lastIndex {
+			return nil, fmt.Errorf("%w : %q has a catch-all parameter before its end", ErrInvalidPath, path)
+		}
+		if contains(names, name) {
+			return nil, fmt.Errorf("%w : %q has the parameter %s twice", ErrInvalidPath, path, name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
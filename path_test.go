@@ -0,0 +1,77 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+func TestParsePathParams(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "/list"},
+		{path: "/view/:id/:name", want: []string{"id", "name"}},
+		{path: "/files/*rest", want: []string{"rest"}},
+		{path: "", wantErr: true},
+		{path: "list", wantErr: true},
+		{path: "/view/:", wantErr: true},
+		{path: "/view/a:id", wantErr: true},
+		{path: "/view/:id/:id", wantErr: true},
+		{path: "/files/*rest/more", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePathParams(tt.path)
+		if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrInvalidPath)) {
+			t.Errorf("ParsePathParams(%q) got error %v, want error %v", tt.path, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePathParams(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAddActionInvalidPath(t *testing.T) {
+	s := newTestServer(t)
+	widget := s.CreateWidget("test")
+	for _, path := range []string{"", "view/:id"} {
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, ErrInvalidPath) {
+					t.Errorf("got panic with %v for path %q, want %v", err, path, ErrInvalidPath)
+				}
+			}()
+			widget.AddAction("invalid", pb.MethodKind_GET, path, noopHandler)
+		}()
+	}
+	if s.HasAction(context.Background(), "test", "invalid", nil) {
+		t.Error("action with an invalid path registered")
+	}
+	if err := widget.TryAddAction("other", pb.MethodKind_GET, "", noopHandler); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("got %v, want %v", err, ErrInvalidPath)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrForbidden = status.Error(codes.PermissionDenied, "permission denied")
+
+// Kind of operation checked against the rights of a role (same order as the puzzle rights service).
+type RightAction int
+
+const (
+	RightAccess RightAction = iota
+	RightCreate
+	RightUpdate
+	RightDelete
+)
+
+// PermissionChecker query the rights of a user (0 for an anonymous one) on the object
+// associated with a role, an implementation will usually call the puzzle rights service.
+type PermissionChecker interface {
+	CheckPermission(ctx context.Context, userId uint64, roleObjectId uint64, action RightAction) (bool, error)
+}
+
+type roleRequirement struct {
+	objectId uint64
+	action   RightAction
+}
+
+// decisions of a Process call, to not query the checker twice for the same right
+type permissionCache struct {
+	mutex     sync.Mutex
+	checker   PermissionChecker
+	userId    uint64
+	decisions map[roleRequirement]bool
+}
+
+// Checker queried by the actions with RequireRole and by HasPermission.
+func WithPermissionChecker(checker PermissionChecker) Option {
+	return func(o *serverOptions) {
+		o.permissions = checker
+	}
+}
+
+// Skip the handler when the user does not have the right for actionFlag on the object
+// associated with a role, the call is then rejected with ErrForbidden (the server must use WithPermissionChecker).
+// The option can be repeated to require several rights.
+func RequireRole(roleObjectId uint64, actionFlag RightAction) ActionOption {
+	return func(a *action) {
+		a.roles = append(a.roles, roleRequirement{objectId: roleObjectId, action: actionFlag})
+	}
+}
+
+// Check a right of the user of the call in an handler, the decisions are cached during the call
+// (including the ones of RequireRole). Return false when the server has no PermissionChecker.
+func HasPermission(ctx context.Context, roleObjectId uint64, actionFlag RightAction) (bool, error) {
+	cache, ok := ctx.Value(permissionContextKey).(*permissionCache)
+	if !ok {
+		return false, nil
+	}
+	return cache.check(ctx, roleRequirement{objectId: roleObjectId, action: actionFlag})
+}
+
+func contextWithPermissionCache(ctx context.Context, checker PermissionChecker, data Data) (context.Context, *permissionCache) {
+	// an invalid or missing id is handled as anonymous
+	userId, _ := GetCurrentUserId(data)
+	cache := &permissionCache{checker: checker, userId: userId, decisions: map[roleRequirement]bool{}}
+	return context.WithValue(ctx, permissionContextKey, cache), cache
+}
+
+func (c *permissionCache) check(ctx context.Context, requirement roleRequirement) (bool, error) {
+	c.mutex.Lock()
+	allowed, ok := c.decisions[requirement]
+	c.mutex.Unlock()
+	if ok {
+		return allowed, nil
+	}
+
+	allowed, err := c.checker.CheckPermission(ctx, c.userId, requirement.objectId, requirement.action)
+	if err != nil {
+		// errors are not cached, the next check will retry
+		return false, err
+	}
+
+	c.mutex.Lock()
+	c.decisions[requirement] = allowed
+	c.mutex.Unlock()
+	return allowed, nil
+}
@@ -0,0 +1,80 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errInvalidInterval = errors.New("polling interval must be positive")
+
+// Mark the action as a long polling one : its handler can block (with WaitForUpdate)
+// during at most maxWait (still bounded by the server wide timeout from WithProcessTimeout).
+// Reaching maxWait is expected, so the handler is left to answer instead of failing with ErrActionTimeout.
+func LongPolling(maxWait time.Duration) ActionOption {
+	return func(a *action) {
+		a.timeout = maxWait
+		a.longPolling = true
+	}
+}
+
+// Limit the duration of the action (still bounded by the server wide timeout from WithProcessTimeout) :
+// its context is cancelled after timeout and Process returns ErrActionTimeout without waiting for the handler.
+// Once its context is done, the handler must stop using the data it received (Process no longer reads them),
+// a goroutine which needs them afterward must work on a copy (see CloneData).
+func ActionTimeout(timeout time.Duration) ActionOption {
+	return func(a *action) {
+		a.timeout = timeout
+	}
+}
+
+// Call check every interval until it returns true or an error, return false without error
+// when the context ends first (the handler should then answer with a no-change response).
+// An error is returned when interval is not positive.
+func WaitForUpdate(ctx context.Context, check func() (bool, error), interval time.Duration) (bool, error) {
+	if interval <= 0 {
+		return false, errInvalidInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := check()
+		if err != nil || ok {
+			return ok, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// the action timeout can not exceed the server one
+func processTimeout(actionTimeout time.Duration, serverTimeout time.Duration) time.Duration {
+	if actionTimeout <= 0 || (serverTimeout > 0 && serverTimeout < actionTimeout) {
+		return serverTimeout
+	}
+	return actionTimeout
+}
@@ -0,0 +1,85 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+func TestWaitForUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		readyAt   int // number of checks before the condition becomes true (0 for never)
+		checkErr  error
+		interval  time.Duration
+		wantOk    bool
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "condition becomes true", readyAt: 3, interval: time.Millisecond, wantOk: true, wantCalls: 3},
+		{name: "timeout without change", readyAt: 0, interval: time.Millisecond, wantOk: false},
+		{name: "check error", checkErr: errInternalTest, interval: time.Millisecond, wantErr: errInternalTest, wantCalls: 1},
+		{name: "zero interval", interval: 0, wantErr: errInvalidInterval},
+		{name: "negative interval", interval: -time.Second, wantErr: errInvalidInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			calls := 0
+			ok, err := WaitForUpdate(ctx, func() (bool, error) {
+				calls++
+				return calls == tt.readyAt, tt.checkErr
+			}, tt.interval)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOk {
+				t.Errorf("got %v, want %v", ok, tt.wantOk)
+			}
+			if tt.wantCalls != 0 && calls != tt.wantCalls {
+				t.Errorf("got %d checks, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestLongPolling(t *testing.T) {
+	s := newTestServer(t)
+	s.CreateWidget("widget").AddAction("poll", pb.MethodKind_GET, "/poll", func(ctx context.Context, data Data) (string, string, []byte, error) {
+		updated, err := WaitForUpdate(ctx, func() (bool, error) { return false, nil }, time.Millisecond)
+		if err != nil || updated {
+			return "", "", nil, err
+		}
+		return "", "noChange", nil, nil
+	}, LongPolling(20*time.Millisecond))
+
+	response, _, err := invoke(context.Background(), s, "widget", "poll", Data{})
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	if response.TemplateName != "noChange" {
+		t.Errorf("got templateName %q, want the no-change response", response.TemplateName)
+	}
+}
@@ -0,0 +1,46 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"bytes"
+	"sync"
+)
+
+// buffers only used during a call by the server, the data of the call are not pooled
+// because the handlers can keep them after the call (like the async actions)
+
+// buffers of encodeValue (used by MarshalData and AddDataAction)
+var encodeBufferPool = sync.Pool{New: func() any {
+	return new(bytes.Buffer)
+}}
+
+// buffers of chunkWriter (streamChunkSize bytes each)
+var chunkPool = sync.Pool{New: func() any {
+	buffer := make([]byte, 0, streamChunkSize)
+	return &buffer
+}}
+
+func getPooledChunk() []byte {
+	return (*chunkPool.Get().(*[]byte))[:0]
+}
+
+func putPooledChunk(buffer []byte) {
+	chunkPool.Put(&buffer)
+}
@@ -0,0 +1,148 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Returned for the calls exceeding a rate limit (see RateLimit).
+var ErrRateLimited = status.Error(codes.ResourceExhausted, "rate limit exceeded")
+
+type rateEntry struct {
+	start time.Time
+	count uint64
+}
+
+// fixed window counter shared by the rate limiting helpers
+type rateLimiter struct {
+	mutex     sync.Mutex
+	limit     uint64
+	window    time.Duration
+	lastSweep time.Time
+	entries   map[string]*rateEntry
+}
+
+func newRateLimiter(limit uint64, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, lastSweep: time.Now(), entries: map[string]*rateEntry{}}
+}
+
+func (l *rateLimiter) allow(key string) bool {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.lastSweep) > l.window {
+		for entryKey, entry := range l.entries {
+			if now.Sub(entry.start) > l.window {
+				delete(l.entries, entryKey)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.start) > l.window {
+		l.entries[key] = &rateEntry{start: now, count: 1}
+		return true
+	}
+	if entry.count >= l.limit {
+		return false
+	}
+	entry.count++
+	return true
+}
+
+// key of the anonymous calls whose client ip is unknown (no grpc peer, like in tests),
+// they share the same limit
+const unknownIp = "unknown"
+
+// Limit the calls of anonymous users (no "Id" entry in data) by client ip,
+// authenticated users are not concerned.
+type IpRateLimiter struct {
+	limiter        *rateLimiter
+	trustedProxies []netip.Prefix
+}
+
+// Allow limit calls by ip during each window, the trustedProxies are used
+// to read the client ip from the forwarded header (see GetClientIp).
+// Without trustedProxies the ip read is the one of the puzzle frontend, so all the anonymous
+// users share the same limit and one of them can exhaust it for everyone.
+func MakeIpRateLimiter(limit uint64, window time.Duration, trustedProxies ...netip.Prefix) IpRateLimiter {
+	return IpRateLimiter{limiter: newRateLimiter(limit, window), trustedProxies: trustedProxies}
+}
+
+// Return true when the ip has not exceeded its limit in the current window.
+func (l IpRateLimiter) Allow(ip string) bool {
+	return l.limiter.allow(ip)
+}
+
+// Wrap an handler to reject anonymous calls exceeding the limit with a codes.ResourceExhausted status.
+func (l IpRateLimiter) Wrap(handler ActionHandler) ActionHandler {
+	return func(ctx context.Context, data Data) (string, string, []byte, error) {
+		if _, err := GetCurrentUserId(data); err == nil {
+			return handler(ctx, data)
+		}
+
+		if !l.Allow(clientIpKey(ctx, l.trustedProxies)) {
+			return "", "", nil, ErrRateLimited
+		}
+		return handler(ctx, data)
+	}
+}
+
+type actionRateLimit struct {
+	limiter        *rateLimiter
+	trustedProxies []netip.Prefix
+}
+
+// Allow limit calls of the action during each window by user, or by client ip for anonymous calls
+// (the trustedProxies are used to read it from the forwarded header, see GetClientIp).
+// Without trustedProxies the ip read is the one of the puzzle frontend, so all the anonymous
+// users share the same limit and one of them can exhaust it for everyone.
+// The calls exceeding the limit are rejected with ErrRateLimited before calling the handler.
+func RateLimit(limit uint64, window time.Duration, trustedProxies ...netip.Prefix) ActionOption {
+	return func(a *action) {
+		a.rateLimit = &actionRateLimit{limiter: newRateLimiter(limit, window), trustedProxies: trustedProxies}
+	}
+}
+
+func (l *actionRateLimit) allow(ctx context.Context, data Data) bool {
+	if userId, err := GetCurrentUserId(data); err == nil {
+		return l.limiter.allow("user:" + strconv.FormatUint(userId, 10))
+	}
+	return l.limiter.allow("ip:" + clientIpKey(ctx, l.trustedProxies))
+}
+
+func clientIpKey(ctx context.Context, trustedProxies []netip.Prefix) string {
+	ip, err := GetClientIp(ctx, trustedProxies...)
+	if err != nil {
+		// no peer or a peer without ip (like a unix socket)
+		return unknownIp
+	}
+	return ip
+}
@@ -0,0 +1,71 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc/peer"
+)
+
+func peerContext(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 4000}})
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   context.Context
+		second  context.Context
+		data    Data
+		wantErr error
+	}{
+		{name: "same user", first: peerContext("10.0.0.1"), second: peerContext("10.0.0.2"), data: Data{UserIdKey: 1}, wantErr: ErrRateLimited},
+		{name: "same ip", first: peerContext("10.0.0.1"), second: peerContext("10.0.0.1"), data: Data{}, wantErr: ErrRateLimited},
+		{name: "distinct ips", first: peerContext("10.0.0.1"), second: peerContext("10.0.0.2"), data: Data{}},
+		{name: "without peer", first: context.Background(), second: context.Background(), data: Data{}, wantErr: ErrRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.CreateWidget("test").AddAction("search", pb.MethodKind_GET, "/search", noopHandler, RateLimit(1, time.Minute))
+
+			if _, _, err := invoke(tt.first, s, "test", "search", tt.data); err != nil {
+				t.Fatalf("unexpected error on first call : %v", err)
+			}
+			if _, _, err := invoke(tt.second, s, "test", "search", tt.data); err != tt.wantErr {
+				t.Errorf("got %v on second call, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIpRateLimiterWithoutPeer(t *testing.T) {
+	handler := MakeIpRateLimiter(1, time.Minute).Wrap(noopHandler)
+	if _, _, _, err := handler(context.Background(), Data{}); err != nil {
+		t.Fatalf("unexpected error on first call : %v", err)
+	}
+	if _, _, _, err := handler(context.Background(), Data{}); err != ErrRateLimited {
+		t.Errorf("got %v on second call, want %v", err, ErrRateLimited)
+	}
+}
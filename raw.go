@@ -0,0 +1,70 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"mime"
+	"strconv"
+)
+
+const contentDispositionName = "Content-Disposition"
+
+// Body of a RAW action with the http metadata the frontend should serve it with,
+// each header is sent as a "puzzle-" prefixed header metadata (see SetResponseHeader),
+// the Status as "puzzle-status" when not zero.
+type RawResponse struct {
+	ContentType string
+	Headers     map[string]string
+	Body        []byte
+	Status      int
+}
+
+// Build a RawResponse serving body as a file to download named filename.
+func MakeDownload(filename string, contentType string, body []byte) RawResponse {
+	return RawResponse{
+		ContentType: contentType, Headers: map[string]string{contentDispositionName: attachmentDisposition(filename)}, Body: body,
+	}
+}
+
+// Set the headers of response and return the values expected from a RAW action handler :
+//
+//	return WriteRaw(ctx, MakeDownload("report.pdf", "application/pdf", pdfBytes))
+func WriteRaw(ctx context.Context, response RawResponse) (string, string, []byte, error) {
+	if response.ContentType != "" {
+		if err := SetResponseHeader(ctx, contentTypeName, response.ContentType); err != nil {
+			return "", "", nil, err
+		}
+	}
+	for name, value := range response.Headers {
+		if err := SetResponseHeader(ctx, name, value); err != nil {
+			return "", "", nil, err
+		}
+	}
+	if response.Status != 0 {
+		if err := SetResponseHeader(ctx, statusName, strconv.Itoa(response.Status)); err != nil {
+			return "", "", nil, err
+		}
+	}
+	return "", "", response.Body, nil
+}
+
+func attachmentDisposition(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
@@ -0,0 +1,112 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"strings"
+)
+
+// Redact by default the values of the keys (case insensitive, at any depth like inside "formData")
+// in the request contents logged or reported by the server and its helpers (see RedactForLogging).
+func WithRedactedKeys(keys ...string) Option {
+	return func(o *serverOptions) {
+		for _, key := range keys {
+			o.redactedKeys = append(o.redactedKeys, strings.ToLower(key))
+		}
+	}
+}
+
+// Return a copy of data where the values of the keys (case insensitive) are replaced,
+// at any depth (nested maps like "formData" and slices of maps).
+func Redact(data Data, keys ...string) Data {
+	lowerKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lowerKeys = append(lowerKeys, strings.ToLower(key))
+	}
+	return redactData(data, func(lowerKey string) bool {
+		return contains(lowerKeys, lowerKey)
+	})
+}
+
+// Return a copy of data safe to log : the values of the keys from WithRedactedKeys are replaced
+// and the files are left out.
+func RedactForLogging(ctx context.Context, data Data) Data {
+	return redactForLogging(data, redactedKeysFromContext(ctx), nil)
+}
+
+func contextWithRedactedKeys(ctx context.Context, keys []string) context.Context {
+	if len(keys) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, redactionContextKey, keys)
+}
+
+func redactedKeysFromContext(ctx context.Context) []string {
+	keys, _ := ctx.Value(redactionContextKey).([]string)
+	return keys
+}
+
+// keys are matched exactly and patterns as substrings, both in lower case
+func redactForLogging(data Data, keys []string, patterns []string) Data {
+	res := redactData(data, func(lowerKey string) bool {
+		return contains(keys, lowerKey) || matchAny(lowerKey, patterns)
+	})
+	delete(res, FilesKey)
+	delete(res, FilePartsKey)
+	return res
+}
+
+func redactData(data Data, match func(string) bool) Data {
+	if data == nil {
+		return nil
+	}
+	res := make(Data, len(data))
+	for key, value := range data {
+		if match(strings.ToLower(key)) {
+			res[key] = redactedValue
+		} else {
+			res[key] = redactValue(value, match)
+		}
+	}
+	return res
+}
+
+func redactValue(value any, match func(string) bool) any {
+	switch casted := value.(type) {
+	case Data:
+		return redactData(casted, match)
+	case []any:
+		res := make([]any, len(casted))
+		for i, elem := range casted {
+			res[i] = redactValue(elem, match)
+		}
+		return res
+	}
+	return value
+}
+
+func matchAny(lowerKey string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(lowerKey, pattern) {
+			return true
+		}
+	}
+	return false
+}
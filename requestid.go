@@ -0,0 +1,91 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// incoming metadata keys checked (in order) to reuse the correlation id of the frontend
+var requestIdHeaders = []string{"x-request-id", "x-correlation-id"}
+
+// Add a reference to the messages of internal errors ("internal service error (ref: 1a2b3c4d5e6f)"),
+// the same reference is logged with the error as "requestId" to help the support.
+func WithErrorReference() Option {
+	return func(o *serverOptions) {
+		o.errorReference = true
+	}
+}
+
+// Return the id of the current call, taken from the "x-request-id" or "x-correlation-id"
+// incoming metadata when sent by the frontend, otherwise generated by Process.
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdContextKey).(string)
+	return requestId
+}
+
+// keep the id already set (see Upload)
+func contextWithRequestId(ctx context.Context) context.Context {
+	if RequestIdFromContext(ctx) != "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIdContextKey, incomingRequestId(ctx))
+}
+
+func incomingRequestId(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, header := range requestIdHeaders {
+			if values := md.Get(header); len(values) != 0 && values[0] != "" {
+				return values[0]
+			}
+		}
+	}
+
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(idBytes); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(idBytes)
+}
+
+func requestIdField(ctx context.Context) zap.Field {
+	return zap.String("requestId", RequestIdFromContext(ctx))
+}
+
+func (s widgetServerAdapter) internalMessage(ctx context.Context) string {
+	if s.options.errorReference {
+		return fmt.Sprintf("%s (ref: %s)", internalErrorMsg, RequestIdFromContext(ctx))
+	}
+	return internalErrorMsg
+}
+
+func (s widgetServerAdapter) internalError(ctx context.Context) error {
+	if s.options.errorReference {
+		return status.Error(codes.Internal, s.internalMessage(ctx))
+	}
+	return ErrInternal
+}
@@ -0,0 +1,86 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var referencePattern = regexp.MustCompile(`^internal service error \(ref: ([0-9a-z-]+)\)$`)
+
+func TestErrorReference(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming metadata.MD
+		wantRef  string
+	}{
+		{name: "generated"},
+		{name: "request id", incoming: metadata.Pairs("x-request-id", "front-42"), wantRef: "front-42"},
+		{name: "correlation id", incoming: metadata.Pairs("x-correlation-id", "corr-7"), wantRef: "corr-7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, logs := newObservedTestServer(t, WithErrorReference())
+			s.CreateWidget("test").AddAction("fail", pb.MethodKind_POST, "/fail", failingHandler)
+
+			ctx := context.Background()
+			if tt.incoming != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.incoming)
+			}
+			_, _, err := invoke(ctx, s, "test", "fail", Data{})
+			if status.Code(err) != codes.Internal {
+				t.Fatalf("got %v, want an internal error", err)
+			}
+			matches := referencePattern.FindStringSubmatch(status.Convert(err).Message())
+			if matches == nil {
+				t.Fatalf("no reference in %q", status.Convert(err).Message())
+			}
+			ref := matches[1]
+			if tt.wantRef != "" && ref != tt.wantRef {
+				t.Errorf("got reference %q, want %q", ref, tt.wantRef)
+			}
+
+			logged := false
+			for _, entry := range logs.All() {
+				if entry.ContextMap()["requestId"] == ref {
+					logged = true
+				}
+			}
+			if !logged {
+				t.Errorf("reference %q not logged, got %v", ref, logs.All())
+			}
+		})
+	}
+}
+
+func TestWithoutErrorReference(t *testing.T) {
+	s := newTestServer(t)
+	s.CreateWidget("test").AddAction("fail", pb.MethodKind_POST, "/fail", failingHandler)
+
+	if _, _, err := invoke(context.Background(), s, "test", "fail", Data{}); err != ErrInternal {
+		t.Errorf("got %v, want %v", err, ErrInternal)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+const contentTypeName = "Content-Type"
+const statusName = "Status"
+
+// Response returned by an HandlerV2 :
+//
+//   - Redirect is a redirect path (ignored if empty)
+//   - TemplateName and Data are used to render a templated action (Data is marshalled in json)
+//   - Raw is the body of a RAW action, with its ContentType (sent as the "puzzle-content-type" header)
+//   - Status is an http status for the frontend (sent as the "puzzle-status" header when not zero)
+type Response struct {
+	Redirect     string
+	TemplateName string
+	Data         Data
+	Raw          []byte
+	ContentType  string
+	Status       int
+}
+
+type HandlerV2 = func(context.Context, Data) (Response, error)
+
+// Like AddAction with an handler returning a Response.
+func (w Widget) AddActionV2(actionName string, kind pb.MethodKind, path string, handler HandlerV2, opts ...ActionOption) {
+	w.AddAction(actionName, kind, path, adaptHandlerV2(handler), opts...)
+}
+
+// Indicate which query parameters should be transmitted (like AddActionWithQuery does).
+func QueryNames(names ...string) ActionOption {
+	return func(a *action) {
+		a.queryNames = append(a.queryNames, names...)
+	}
+}
+
+func adaptHandlerV2(handler HandlerV2) ActionHandler {
+	return func(ctx context.Context, data Data) (string, string, []byte, error) {
+		response, err := handler(ctx, data)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return writeResponse(ctx, response)
+	}
+}
+
+func writeResponse(ctx context.Context, response Response) (string, string, []byte, error) {
+	if response.ContentType != "" {
+		if err := SetResponseHeader(ctx, contentTypeName, response.ContentType); err != nil {
+			return "", "", nil, err
+		}
+	}
+	if response.Status != 0 {
+		if err := SetResponseHeader(ctx, statusName, strconv.Itoa(response.Status)); err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	if response.Raw != nil {
+		return response.Redirect, response.TemplateName, response.Raw, nil
+	}
+	if response.Data == nil {
+		return response.Redirect, response.TemplateName, nil, nil
+	}
+	resData, err := json.Marshal(response.Data)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return response.Redirect, response.TemplateName, resData, nil
+}
@@ -0,0 +1,171 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HtmlSanitizer allow to plug any sanitization library in GetSanitizedHtml.
+type HtmlSanitizer interface {
+	Sanitize(input string) (string, error)
+}
+
+// Whitelist based HtmlSanitizer, AllowedTags map each allowed tag to its allowed attributes.
+//
+// Disallowed tags are removed (but their text is kept), except the ones in DroppedTags
+// which are removed with all their content. Event handler attributes ("on...") are always
+// removed and url attributes ("href", "src") only accept relative urls or the AllowedSchemes.
+type HtmlPolicy struct {
+	AllowedTags    map[string][]string
+	DroppedTags    []string
+	AllowedSchemes []string
+}
+
+// A policy accepting common formatting, links and images.
+func DefaultHtmlPolicy() HtmlPolicy {
+	return HtmlPolicy{
+		AllowedTags: map[string][]string{
+			"a": {"href", "title"}, "b": nil, "blockquote": nil, "br": nil, "code": nil, "em": nil,
+			"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil, "hr": nil, "i": nil,
+			"img": {"src", "alt", "title"}, "li": nil, "ol": nil, "p": nil, "pre": nil, "s": nil,
+			"span": nil, "strong": nil, "sub": nil, "sup": nil, "u": nil, "ul": nil,
+		},
+		DroppedTags:    []string{"script", "style", "iframe", "object", "embed", "noscript", "template"},
+		AllowedSchemes: []string{"http", "https", "mailto"},
+	}
+}
+
+func (p HtmlPolicy) Sanitize(input string) (string, error) {
+	var builder strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(input))
+	dropped, dropDepth := "", 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return "", err
+			}
+			return builder.String(), nil
+		case html.StartTagToken:
+			token := tokenizer.Token()
+			if dropped != "" {
+				if token.Data == dropped {
+					dropDepth++
+				}
+			} else if p.isDropped(token.Data) {
+				dropped, dropDepth = token.Data, 1
+			} else {
+				p.writeTag(&builder, token, false)
+			}
+		case html.SelfClosingTagToken:
+			if dropped == "" {
+				p.writeTag(&builder, tokenizer.Token(), true)
+			}
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			if dropped != "" {
+				if token.Data == dropped {
+					if dropDepth--; dropDepth == 0 {
+						dropped = ""
+					}
+				}
+			} else if _, ok := p.AllowedTags[token.Data]; ok {
+				builder.WriteString("</")
+				builder.WriteString(token.Data)
+				builder.WriteByte('>')
+			}
+		case html.TextToken:
+			if dropped == "" {
+				builder.WriteString(html.EscapeString(tokenizer.Token().Data))
+			}
+		}
+		// comments and doctypes are always removed
+	}
+}
+
+func (p HtmlPolicy) isDropped(tag string) bool {
+	for _, droppedTag := range p.DroppedTags {
+		if tag == droppedTag {
+			return true
+		}
+	}
+	return false
+}
+
+func (p HtmlPolicy) writeTag(builder *strings.Builder, token html.Token, selfClosing bool) {
+	allowedAttrs, ok := p.AllowedTags[token.Data]
+	if !ok {
+		return
+	}
+
+	builder.WriteByte('<')
+	builder.WriteString(token.Data)
+	for _, attr := range token.Attr {
+		if attr.Namespace != "" || strings.HasPrefix(attr.Key, "on") || !contains(allowedAttrs, attr.Key) {
+			continue
+		}
+		if (attr.Key == "href" || attr.Key == "src") && !p.isSafeUrl(attr.Val) {
+			continue
+		}
+		builder.WriteByte(' ')
+		builder.WriteString(attr.Key)
+		builder.WriteString("=\"")
+		builder.WriteString(html.EscapeString(attr.Val))
+		builder.WriteByte('"')
+	}
+	if selfClosing {
+		builder.WriteString(" /")
+	}
+	builder.WriteByte('>')
+}
+
+func (p HtmlPolicy) isSafeUrl(value string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return false
+	}
+	return parsed.Scheme == "" || contains(p.AllowedSchemes, strings.ToLower(parsed.Scheme))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Read the string value of key and return it cleaned by sanitizer
+// (DefaultHtmlPolicy is used when sanitizer is nil).
+func GetSanitizedHtml(data Data, key string, sanitizer HtmlSanitizer) (string, error) {
+	value, err := AsString(data[key])
+	if err != nil {
+		return "", err
+	}
+	if sanitizer == nil {
+		sanitizer = DefaultHtmlPolicy()
+	}
+	return sanitizer.Sanitize(value)
+}
@@ -0,0 +1,80 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHtmlPolicySanitize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "script tag", input: `<script>alert(1)</script>hello`, want: `hello`},
+		{name: "event handler", input: `<img src=x onerror=alert(1)>`, want: `<img src="x">`},
+		{name: "click handler", input: `<p onclick="steal()">text</p>`, want: `<p>text</p>`},
+		{name: "javascript url", input: `<a href="javascript:alert(1)">link</a>`, want: `<a>link</a>`},
+		{name: "mixed case javascript url", input: `<a href=" JaVaScRiPt:alert(1)">link</a>`, want: `<a>link</a>`},
+		{name: "encoded javascript url", input: `<a href="jav&#x09;ascript:alert(1)">link</a>`, want: `<a>link</a>`},
+		{name: "data url", input: `<img src="data:text/html;base64,PHNjcmlwdD4=">`, want: `<img>`},
+		{name: "script in svg", input: `<svg onload=alert(1)><script>alert(1)</script></svg>`, want: ``},
+		{name: "split script tag", input: `<scr<script>ipt>alert(1)</script>`, want: `ipt&gt;alert(1)`},
+		{name: "attribute breakout", input: `"><img src=x onerror=alert(1)//`, want: `&#34;&gt;`},
+		{name: "iframe", input: `<iframe src="https://evil.test"></iframe>after`, want: `after`},
+		{name: "style", input: `<style>body{}</style><p>text</p>`, want: `<p>text</p>`},
+		{name: "formatting", input: `<b>bold</b> <em>it</em><br/>`, want: `<b>bold</b> <em>it</em><br />`},
+		{name: "safe link", input: `<a href="https://x.test/?a=1&b=2" title="t">l</a>`, want: `<a href="https://x.test/?a=1&amp;b=2" title="t">l</a>`},
+		{name: "unknown tag", input: `<marquee>text</marquee>`, want: `text`},
+		{name: "text", input: `1 < 2`, want: `1 &lt; 2`},
+	}
+	policy := DefaultHtmlPolicy()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.Sanitize(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type upperSanitizer struct{}
+
+func (upperSanitizer) Sanitize(input string) (string, error) {
+	return strings.ToUpper(input), nil
+}
+
+func TestGetSanitizedHtml(t *testing.T) {
+	data := Data{"content": `<b onmouseover="x()">rich</b>`}
+
+	got, err := GetSanitizedHtml(data, "content", nil)
+	if err != nil || got != `<b>rich</b>` {
+		t.Errorf("got %q and error %v with the default policy", got, err)
+	}
+	got, err = GetSanitizedHtml(data, "content", upperSanitizer{})
+	if err != nil || got != `<B ONMOUSEOVER="X()">RICH</B>` {
+		t.Errorf("got %q and error %v with a custom sanitizer", got, err)
+	}
+}
@@ -22,137 +22,688 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"time"
 
-	"github.com/dvaumoron/puzzlegrpcserver"
+	"github.com/dvaumoron/puzzletelemetry"
 	pb "github.com/dvaumoron/puzzlewidgetservice"
 	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
-const formKey = "formData"
+// same tracer name as the spans of puzzlegrpcserver
+const grpcKey = "puzzleGRPCServer"
 const dataKey = "puzzledata.json"
-const filesKey = "Files"
-const urlKey = "CurrentUrl"
-const userKey = "Id"
 
-var errWidgetNotFound = errors.New("widget not found")
-var errActionNotFound = errors.New("action not found")
-var errInternal = errors.New("internal service error")
+const internalErrorMsg = "internal service error"
 
-type Data = map[string]any
-type ActionHandler = func(context.Context, Data) (string, string, []byte, error)
+// Errors returned to the frontend, as grpc status to allow it to distinguish a miss from a failure.
+var ErrWidgetNotFound = status.Error(codes.NotFound, "widget not found")
+var ErrActionNotFound = status.Error(codes.NotFound, "action not found")
+var ErrInternal = status.Error(codes.Internal, internalErrorMsg)
+var ErrActionTimeout = status.Error(codes.DeadlineExceeded, "action timed out")
 
-type action struct {
-	kind       pb.MethodKind
-	path       string
-	queryNames []string
-	handler    ActionHandler
-}
+var errRawWithTemplate = errors.New("RAW action returned a templateName")
+var errResponseTooLarge = status.Error(codes.ResourceExhausted, "response too large")
+var errDataTooDeep = status.Error(codes.InvalidArgument, "data nesting too deep")
+var errRecoveredPanic = errors.New("recovered panic in handler")
+var errNotJsonData = errors.New("templated action returned data which are not valid json")
+var errReservedKey = errors.New("templated action returned data with a reserved key")
 
-type Widget map[string]action
-
-// based on gin path convention, with the path "/view/:id/:name"
-// the map passed to handler will contains "pathData/id" and "pathData/name" entries
-// handler returned values are supposed to be redirect, templateName and data :
-//
-//  1. redirect is a redirect path (ignored if empty), to build an absolute one on the site the map contains the "CurrentUrl" entry
-//
-//  2. data could be :
-//
-//     - a json marshalled map which entries will be added to the data passed to the template engine with templateName
-//
-//     - or any raw data when the action kind is pb.MethodKind_RAW
-func (w Widget) AddAction(actionName string, kind pb.MethodKind, path string, handler ActionHandler) {
-	w[actionName] = action{kind: kind, path: path, handler: handler}
+// statuses of this package an handler can return (like ErrRateLimited with IpRateLimiter),
+// the other errors are logged and hidden behind an internal error
+var handlerStatuses = []error{
+	ErrRateLimited, ErrOverloaded, ErrTooManyJobs, ErrJobNotFound, ErrJobsStopped, ErrUnauthenticated,
+	ErrForbidden, ErrInvalidCsrfToken, ErrFileType, ErrFileTooLarge, ErrActionTimeout,
 }
 
-// Like AddAction but allow to indicate which query parameters should be transmitted.
-func (w Widget) AddActionWithQuery(actionName string, kind pb.MethodKind, path string, queryNames []string, handler ActionHandler) {
-	w[actionName] = action{kind: kind, path: path, queryNames: queryNames, handler: handler}
-}
+type Data = map[string]any
+type ActionHandler = func(context.Context, Data) (string, string, []byte, error)
 
 type widgetServerAdapter struct {
 	pb.UnimplementedWidgetServer
-	widgets map[string]Widget
-	logger  *otelzap.Logger
+	registry *registry
+	logger   *otelzap.Logger
+	tracer   trace.Tracer
+	options  serverOptions
+	metrics  processMetrics
+	workers  *workerPool
 }
 
 func (s widgetServerAdapter) GetWidget(ctx context.Context, request *pb.WidgetRequest) (*pb.WidgetResponse, error) {
+	s.registry.lock.RLock()
+	defer s.registry.lock.RUnlock()
+
 	widgetName := request.Name
-	widget, ok := s.widgets[widgetName]
+	widget, ok := s.registry.widgets[widgetName]
 	if !ok {
-		return nil, errWidgetNotFound
+		return nil, ErrWidgetNotFound
+	}
+
+	mode := s.options.trailingSlash
+	if mode != TrailingSlashStrict {
+		if err := grpc.SetHeader(ctx, metadata.Pairs(trailingSlashHeader, string(mode))); err != nil {
+			s.logger.WarnContext(ctx, "Failed to set trailing slash header", zap.Error(err))
+		}
+	}
+	cached := widget.cached.Load()
+	if cached == nil {
+		var cacheable bool
+		var err error
+		cached, cacheable, err = widget.buildResponse(widgetName, mode, func(a action) bool {
+			return s.isEnabled(ctx, a, nil)
+		})
+		if err != nil {
+			s.logger.WarnContext(ctx, "Failed to marshal widget description", zap.Error(err))
+		} else if cacheable {
+			widget.cached.Store(cached)
+		}
 	}
-	return &pb.WidgetResponse{Name: widgetName, Actions: convertActions(widget)}, nil
+
+	if cached.description != nil {
+		if err := grpc.SetHeader(ctx, metadata.Pairs(descriptionHeader, string(cached.description))); err != nil {
+			s.logger.WarnContext(ctx, "Failed to set description header", zap.Error(err))
+		}
+	}
+	return cached.response, nil
 }
 
-func (s widgetServerAdapter) Process(ctx context.Context, request *pb.ProcessRequest) (*pb.ProcessResponse, error) {
-	widget, ok := s.widgets[request.WidgetName]
+// return the action with the middlewares to apply (global ones first)
+func (s widgetServerAdapter) getAction(widgetName string, actionName string) (action, []ActionMiddleware, error) {
+	s.registry.lock.RLock()
+	defer s.registry.lock.RUnlock()
+
+	widget, ok := s.registry.widgets[widgetName]
 	if !ok {
-		return nil, errWidgetNotFound
+		return action{}, nil, ErrWidgetNotFound
 	}
-	action, ok := widget[request.ActionName]
+	action, ok := widget.actions[actionName]
 	if !ok {
-		return nil, errActionNotFound
+		return action, nil, ErrActionNotFound
 	}
 
-	files := request.Files
-	dataBytes := files[dataKey]
+	middlewares := make([]ActionMiddleware, 0, len(s.registry.middlewares)+len(widget.middlewares))
+	middlewares = append(middlewares, s.registry.middlewares...)
+	middlewares = append(middlewares, widget.middlewares...)
+	return action, middlewares, nil
+}
+
+func (s widgetServerAdapter) Process(ctx context.Context, request *pb.ProcessRequest) (*pb.ProcessResponse, error) {
+	return s.process(ctx, request, nil)
+}
+
+// call is not nil when the call comes from the streaming service (see stream.go)
+func (s widgetServerAdapter) process(ctx context.Context, request *pb.ProcessRequest, call *streamCall) (response *pb.ProcessResponse, err error) {
+	action, middlewares, err := s.getAction(request.WidgetName, request.ActionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if call == nil || !call.reserved {
+		if !acquireActionSlot(s.options.actionSlots) {
+			s.metrics.recordError(ctx, request.WidgetName, request.ActionName, reasonOverloaded)
+			return nil, ErrOverloaded
+		}
+		defer releaseActionSlot(s.options.actionSlots)
+	}
+
+	ctx, span := startActionSpan(ctx, s.tracer, request.WidgetName, request.ActionName)
+	defer func() {
+		endActionSpan(span, response, err)
+	}()
+
+	start := time.Now()
+	defer func() {
+		s.metrics.recordDuration(ctx, request.WidgetName, request.ActionName, time.Since(start))
+	}()
+	requestSize := 0
+	for _, content := range request.Files {
+		requestSize += len(content)
+	}
+	s.metrics.recordRequestSize(ctx, request.WidgetName, request.ActionName, requestSize)
+
+	ctx = contextWithRequestId(ctx)
+	ctx = contextWithLogger(ctx, s.logger, request.WidgetName, request.ActionName)
+	ctx = contextWithRedactedKeys(ctx, s.options.redactedKeys)
 
+	files := request.Files
 	var data Data
-	if err := json.Unmarshal(dataBytes, &data); err != nil {
-		s.logger.ErrorContext(ctx, "Failed to unmarshal data.json from call", zap.Error(err))
-		return nil, errInternal
+	if call != nil && call.data != nil {
+		data = call.data
+	} else if err := s.options.codec.Unmarshal(files[dataKey], &data); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to unmarshal data.json from call", requestIdField(ctx), zap.Error(err))
+		return nil, s.internalError(ctx)
 	}
 	// cleaning for GC
-	dataBytes = nil
 	delete(files, dataKey)
 
+	setSpanUserId(span, data)
+
+	if limit := s.options.maxDataDepth; limit > 0 && exceedDepth(data, limit) {
+		return nil, errDataTooDeep
+	}
+
+	for _, key := range s.options.requiredFields {
+		if !isPresent(data[key]) {
+			return nil, status.Error(codes.InvalidArgument, "missing required field "+key)
+		}
+	}
+
+	var parts map[string]FilePart
+	if call != nil {
+		parts = call.parts
+	}
+	if exceedFileSize(files, parts, fileSizeLimit(action, s.options.maxFileSize)) {
+		return nil, ErrFileTooLarge
+	}
+	if err = checkFileTypes(files, parts, action.fileTypes); err != nil {
+		if err != ErrFileType {
+			s.logger.ErrorContext(ctx, "Failed to read uploaded file", requestIdField(ctx), zap.Error(err))
+			return nil, s.internalError(ctx)
+		}
+		return nil, err
+	}
+
 	if len(files) != 0 {
-		data[filesKey] = files
+		data[FilesKey] = files
+	}
+	if len(parts) != 0 {
+		data[FilePartsKey] = parts
+	}
+
+	if call == nil || call.data == nil {
+		var redirectResponse *pb.ProcessResponse
+		if ctx, redirectResponse, err = s.checkAccess(ctx, action, data); err != nil || redirectResponse != nil {
+			return redirectResponse, err
+		}
+	}
+
+	if s.options.userIdInContext {
+		ctx = contextWithUserId(ctx, data)
+	}
+	if s.options.localeKey != LocaleKey {
+		copyLocale(data, s.options.localeKey)
+	}
+	if s.options.catalog != nil {
+		ctx = contextWithLocalizer(ctx, s.options.catalog, data)
+	}
+
+	ctx, directive := contextWithCacheDirective(ctx)
+	ctx, encoding := contextWithDataEncoding(ctx, s.options.codec, s.options.dataEncodings)
+
+	var collector *eventCollector
+	if s.options.events != nil {
+		ctx, collector = contextWithEventCollector(ctx)
+	}
+
+	timeout := processTimeout(action.timeout, s.options.processTimeout)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	handler := action.handler
+	// the output of a streaming handler is already sent : no replay, size limit or compression
+	streaming := call != nil && call.out != nil && action.stream != nil
+	if streaming {
+		handler = streamingHandler(action.stream, call.out)
+		// the headers can not be set once the output started
+		call.out.setHeaderSender(func() {
+			s.sendHeaders(ctx, directive, data)
+		})
+	}
+	if action.dedupTTL > 0 && !streaming {
+		handler = deduplicate(s.options.submissions, s.registry.submissions, request.WidgetName, request.ActionName, action.dedupTTL, handler)
 	}
+	handler = applyMiddlewares(handler, middlewares)
 
-	redirect, templateName, resData, err := action.handler(ctx, data)
+	audited := action.audited && s.options.audit != nil
+	var auditUserId uint64
+	var paramsHash string
+	if audited {
+		// an invalid or missing id is handled as anonymous
+		auditUserId, _ = GetCurrentUserId(data)
+		if paramsHash, err = hashParams(data); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to hash audited parameters", requestIdField(ctx), zap.Error(err))
+			return nil, s.internalError(ctx)
+		}
+	}
+
+	var redirect, templateName string
+	var resData []byte
+	switch {
+	case action.heavy:
+		redirect, templateName, resData, err = s.callHandlerInPool(ctx, handler, data)
+	case timeout > 0 && !action.longPolling:
+		redirect, templateName, resData, err = s.callHandlerWithDeadline(ctx, handler, data)
+	default:
+		redirect, templateName, resData, err = s.callHandler(ctx, handler, data)
+	}
+	if audited {
+		s.recordAudit(ctx, request.WidgetName, request.ActionName, auditUserId, paramsHash, redirect, err)
+	}
 	if err != nil {
-		s.logger.ErrorContext(ctx, "Failed to handle action", zap.Error(err))
-		return nil, errInternal
+		if err == errRecoveredPanic {
+			s.metrics.recordError(ctx, request.WidgetName, request.ActionName, reasonPanic)
+			return nil, status.Error(s.options.panicCode, s.internalMessage(ctx))
+		}
+		if timeout > 0 && errors.Is(err, context.DeadlineExceeded) {
+			s.metrics.recordError(ctx, request.WidgetName, request.ActionName, reasonTimeout)
+			s.logger.WarnContext(ctx, "Action timed out", requestIdField(ctx), zap.Duration("timeout", timeout))
+			return nil, ErrActionTimeout
+		}
+		if errors.Is(err, context.Canceled) {
+			// the client went away, not a failure of the server
+			s.metrics.recordError(ctx, request.WidgetName, request.ActionName, reasonCanceled)
+			return nil, status.Error(codes.Canceled, err.Error())
+		}
+		s.metrics.recordError(ctx, request.WidgetName, request.ActionName, reasonError)
+		var widgetErr *WidgetError
+		if errors.As(err, &widgetErr) {
+			return s.widgetErrorResponse(ctx, action.kind, widgetErr)
+		}
+		if handlerStatus, ok := asHandlerStatus(err); ok {
+			return nil, handlerStatus
+		}
+		s.logger.ErrorContext(ctx, "Failed to handle action", requestIdField(ctx), zap.Error(err))
+		return nil, s.internalError(ctx)
+	}
+	if s.options.validateResponse && !encoding.used {
+		// data with a negotiated encoding are not json
+		if err = checkResponse(action.kind, templateName, resData); err != nil {
+			s.logger.ErrorContext(ctx, "Invalid handler response", requestIdField(ctx), zap.Error(err))
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	if limit := s.options.maxResponseBytes; limit > 0 && !streaming && len(resData) > limit {
+		if !s.options.truncateResponse || action.kind != pb.MethodKind_RAW {
+			s.logger.ErrorContext(ctx, "Response exceeds the size limit", requestIdField(ctx), zap.Int("size", len(resData)), zap.Int("limit", limit))
+			return nil, errResponseTooLarge
+		}
+		s.logger.WarnContext(ctx, "Truncating response exceeding the size limit", requestIdField(ctx), zap.Int("size", len(resData)), zap.Int("limit", limit))
+		resData = resData[:limit]
+	}
+
+	if threshold := s.options.compressionThreshold; threshold > 0 && !streaming && len(resData) > threshold && acceptGzip(ctx) {
+		if compressed, err := gzipData(resData); err != nil {
+			s.logger.WarnContext(ctx, "Failed to compress response", requestIdField(ctx), zap.Error(err))
+		} else if err = SetResponseHeader(ctx, dataCompressionName, gzipCompression); err != nil {
+			s.logger.WarnContext(ctx, "Failed to set compression header", requestIdField(ctx), zap.Error(err))
+		} else {
+			resData = compressed
+		}
+	}
+
+	if streaming {
+		// when the output has not yet started
+		call.out.writeHeader()
+	} else {
+		s.sendHeaders(ctx, directive, data)
+	}
+	s.metrics.recordResponseSize(ctx, request.WidgetName, request.ActionName, len(resData))
+	if collector != nil {
+		s.publishEvents(ctx, collector, action.kind, request.WidgetName, request.ActionName, data)
 	}
 	return &pb.ProcessResponse{Redirect: redirect, TemplateName: templateName, Data: resData}, nil
 }
 
+func asHandlerStatus(err error) (error, bool) {
+	for _, handlerStatus := range handlerStatuses {
+		if errors.Is(err, handlerStatus) {
+			return handlerStatus, true
+		}
+	}
+	return nil, false
+}
+
+// headers sent with a successful response, built by the handler
+func (s widgetServerAdapter) sendHeaders(ctx context.Context, directive *cacheDirective, data Data) {
+	if err := SetResponseHeader(ctx, cacheControlName, directive.get()); err != nil {
+		s.logger.WarnContext(ctx, "Failed to set cache control header", requestIdField(ctx), zap.Error(err))
+	}
+	if err := sendPendingFlashes(ctx, data); err != nil {
+		s.logger.WarnContext(ctx, "Failed to send flash messages", requestIdField(ctx), zap.Error(err))
+	}
+	if err := sendSessionUpdates(ctx, data); err != nil {
+		s.logger.WarnContext(ctx, "Failed to send session updates", requestIdField(ctx), zap.Error(err))
+	}
+}
+
+// checks of the caller access, a non nil response is a redirection to the login page (see WithLoginUrl)
+func (s widgetServerAdapter) checkAccess(ctx context.Context, action action, data Data) (context.Context, *pb.ProcessResponse, error) {
+	if !s.isEnabled(ctx, action, data) {
+		return ctx, nil, ErrActionNotFound
+	}
+
+	if action.rateLimit != nil {
+		if !action.rateLimit.allow(ctx, data) {
+			return ctx, nil, ErrRateLimited
+		}
+	}
+	if action.authenticated {
+		if _, err := GetCurrentUserId(data); err != nil {
+			if s.options.loginUrl == "" {
+				return ctx, nil, ErrUnauthenticated
+			}
+			return ctx, &pb.ProcessResponse{Redirect: s.options.loginUrl}, nil
+		}
+	}
+	if s.options.permissions != nil {
+		var permissions *permissionCache
+		ctx, permissions = contextWithPermissionCache(ctx, s.options.permissions, data)
+		for _, requirement := range action.roles {
+			allowed, err := permissions.check(ctx, requirement)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "Failed to check permission", requestIdField(ctx), zap.Error(err))
+				return ctx, nil, s.internalError(ctx)
+			}
+			if !allowed {
+				return ctx, nil, ErrForbidden
+			}
+		}
+	} else if len(action.roles) != 0 {
+		s.logger.ErrorContext(ctx, "Action requires a role but the server has no PermissionChecker", requestIdField(ctx))
+		return ctx, nil, s.internalError(ctx)
+	}
+	if action.csrf {
+		if len(s.options.csrfSecret) == 0 {
+			s.logger.ErrorContext(ctx, "Action requires a csrf token but the server has no secret", requestIdField(ctx))
+			return ctx, nil, s.internalError(ctx)
+		}
+		if !VerifyCsrfToken(data, s.options.csrfSecret) {
+			return ctx, nil, ErrInvalidCsrfToken
+		}
+	}
+	return ctx, nil, nil
+}
+
+func (s widgetServerAdapter) callHandler(ctx context.Context, handler ActionHandler, data Data) (redirect string, templateName string, resData []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			s.logger.ErrorContext(ctx, "Recovered panic in handler", requestIdField(ctx), zap.Any("panic", r), zap.ByteString("stack", stack))
+			if s.options.panicHook != nil {
+				s.options.panicHook(ctx, r, stack)
+			}
+			err = errRecoveredPanic
+		}
+	}()
+	return handler(ctx, data)
+}
+
+type handlerResult struct {
+	redirect     string
+	templateName string
+	resData      []byte
+	err          error
+}
+
+// return as soon as the deadline of ctx is exceeded, even when the handler ignores ctx
+// (its goroutine ends later and its result is dropped, the caller must not read data after an abandon
+// and the handler must not touch data once ctx is done)
+func (s widgetServerAdapter) callHandlerWithDeadline(ctx context.Context, handler ActionHandler, data Data) (string, string, []byte, error) {
+	done := make(chan handlerResult, 1)
+	go func() {
+		redirect, templateName, resData, err := s.callHandler(ctx, handler, data)
+		done <- handlerResult{redirect: redirect, templateName: templateName, resData: resData, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.redirect, res.templateName, res.resData, res.err
+	case <-ctx.Done():
+		return "", "", nil, ctx.Err()
+	}
+}
+
 type WidgetServer struct {
-	inner   puzzlegrpcserver.GRPCServer
-	widgets map[string]Widget
+	grpcServer     *grpc.Server
+	listener       net.Listener
+	logger         *otelzap.Logger
+	tracerProvider *sdktrace.TracerProvider
+	tracer         trace.Tracer
+	registry       *registry
+	options        serverOptions
+	metrics        processMetrics
+	workers        *workerPool
+	observability  *http.Server
+	lifecycle      *lifecycle
+	deps           Deps
+	health         *healthState
+	logLevel       zap.AtomicLevel
 }
 
 func Make(serviceName string, version string, opts ...grpc.ServerOption) WidgetServer {
-	grpcServer := puzzlegrpcserver.Make(serviceName, version, opts...)
-	return WidgetServer{inner: grpcServer, widgets: map[string]Widget{}}
+	return MakeWithOptions(serviceName, version, WithGRPCOptions(opts...))
+}
+
+func MakeWithOptions(serviceName string, version string, options ...Option) WidgetServer {
+	serverOpts := defaultOptions()
+	for _, option := range options {
+		option(&serverOpts)
+	}
+
+	logger, tp := puzzletelemetry.Init(serviceName, version)
+	ctx, initSpan := tp.Tracer(grpcKey).Start(context.Background(), "initialization")
+	defer initSpan.End()
+
+	lis, err := net.Listen("tcp", ":"+os.Getenv("SERVICE_PORT"))
+	if err != nil {
+		logger.FatalContext(ctx, "Failed to listen", zap.Error(err))
+	}
+
+	s, err := newWidgetServer(serverOpts, logger, tp)
+	if err != nil {
+		logger.FatalContext(ctx, "Failed to load TLS credentials", zap.Error(err))
+	}
+	s.listener = lis
+	return s
+}
+
+// everything but the listener
+func newWidgetServer(serverOpts serverOptions, logger *otelzap.Logger, tp *sdktrace.TracerProvider) (WidgetServer, error) {
+	logger, logLevel := withAtomicLevel(logger)
+	tracer := tp.Tracer(grpcKey)
+
+	grpcOpts := make([]grpc.ServerOption, 0, len(serverOpts.grpcOptions)+3)
+	grpcOpts = append(grpcOpts, grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()))
+	grpcOpts = append(grpcOpts, grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor()))
+	if serverOpts.certFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(serverOpts.certFile, serverOpts.keyFile)
+		if err != nil {
+			return WidgetServer{}, err
+		}
+		grpcOpts = append(grpcOpts, grpc.Creds(creds))
+	}
+	grpcOpts = append(grpcOpts, serverOpts.grpcOptions...)
+	grpcServer := grpc.NewServer(grpcOpts...)
+
+	healthState := newHealthState()
+	healthpb.RegisterHealthServer(grpcServer, healthState.server)
+	if serverOpts.reflection {
+		reflection.Register(grpcServer)
+	}
+
+	metrics := newProcessMetrics(logger)
+	reg := &registry{
+		widgets: map[string]Widget{}, jobs: newJobStore(serverOpts.maxRunningJobs, serverOpts.codec),
+		scheduler: newScheduler(logger, tracer, serverOpts.codec), submissions: newSubmissionGroup(),
+	}
+
+	var observability *http.Server
+	if serverOpts.observabilityAddr != "" {
+		observability = newObservabilityServer(serverOpts.observabilityAddr, metrics, reg, logLevel)
+	}
+	return WidgetServer{
+		grpcServer: grpcServer, logger: logger, tracerProvider: tp, tracer: tracer,
+		registry: reg, options: serverOpts, metrics: metrics, workers: newWorkerPool(serverOpts.heavyWorkers),
+		observability: observability, lifecycle: &lifecycle{}, deps: newDeps(),
+		health: healthState, logLevel: logLevel,
+	}, nil
 }
 
 func (s WidgetServer) Logger() *otelzap.Logger {
-	return s.inner.Logger
+	return s.logger
+}
+
+// Return the underlying grpc server to register additional services on the same listener
+// (before StartWithContext).
+func (s WidgetServer) GRPC() grpc.ServiceRegistrar {
+	return s.grpcServer
 }
 
 func (s WidgetServer) CreateWidget(widgetName string) Widget {
-	widget, ok := s.widgets[widgetName]
+	s.registry.lock.Lock()
+	defer s.registry.lock.Unlock()
+
+	widget, ok := s.registry.widgets[widgetName]
 	if !ok {
-		widget = Widget{}
-		s.widgets[widgetName] = widget
+		widget = s.newWidget()
+		s.registry.widgets[widgetName] = widget
 	}
 	return widget
 }
 
+func (s WidgetServer) newWidget() Widget {
+	return Widget{&widgetState{
+		lock: &s.registry.lock, logger: s.logger, onDuplicate: s.options.onDuplicate, actions: map[string]action{},
+		jobs: s.registry.jobs, scheduler: s.registry.scheduler,
+	}}
+}
+
+// Register a widget configured by setup while the server is running : the widget is
+// published only once setup returns, so calls never see it partially configured.
+// An existing widget with the same name is replaced.
+func (s WidgetServer) AddWidgetAfterStart(widgetName string, setup func(Widget)) {
+	widget := s.newWidget()
+	setup(widget)
+
+	s.registry.lock.Lock()
+	defer s.registry.lock.Unlock()
+
+	s.registry.widgets[widgetName] = widget
+}
+
+// Unregister a widget, following calls for it fail with ErrWidgetNotFound
+// (the calls in progress are not interrupted). Return false when the widget is unknown.
+func (s WidgetServer) RemoveWidget(widgetName string) bool {
+	s.registry.lock.Lock()
+	defer s.registry.lock.Unlock()
+
+	_, ok := s.registry.widgets[widgetName]
+	delete(s.registry.widgets, widgetName)
+	return ok
+}
+
+// Return a snapshot of the registered widgets and their actions, sorted by name.
+func (s WidgetServer) Widgets() []WidgetInfo {
+	return s.registry.widgetInfos()
+}
+
+// Return a description of every registered action grouped by widget name,
+// each slice is sorted by action name.
+func (s WidgetServer) AllActions() map[string][]ActionInfo {
+	s.registry.lock.RLock()
+	defer s.registry.lock.RUnlock()
+
+	res := make(map[string][]ActionInfo, len(s.registry.widgets))
+	for widgetName, widget := range s.registry.widgets {
+		res[widgetName] = widget.actionInfos()
+	}
+	return res
+}
+
+// Add middlewares applied to the handlers of all widgets, in registration order
+// (the first one is the outermost) and before the ones of each widget.
+func (s WidgetServer) Use(middlewares ...ActionMiddleware) {
+	s.registry.lock.Lock()
+	defer s.registry.lock.Unlock()
+
+	s.registry.middlewares = append(s.registry.middlewares, middlewares...)
+}
+
+// Return the implementation of the grpc service (the one registered by Start), to call
+// the widgets in process (see the widgettest package) or serve them with another transport.
+func (s WidgetServer) Handler() pb.WidgetServer {
+	return s.adapter()
+}
+
+func (s WidgetServer) adapter() widgetServerAdapter {
+	return widgetServerAdapter{
+		registry: s.registry, logger: s.logger, tracer: s.tracer, options: s.options, metrics: s.metrics,
+		workers: s.workers,
+	}
+}
+
+// Serve until the server is stopped by Shutdown, a serving failure is fatal.
 func (s WidgetServer) Start() {
-	pb.RegisterWidgetServer(s.inner, widgetServerAdapter{widgets: s.widgets, logger: s.inner.Logger})
-	s.inner.Start()
+	if err := s.StartWithContext(context.Background()); err != nil {
+		s.logger.Fatal("Failed to serve", zap.Error(err))
+	}
 }
 
-func convertActions(widget Widget) []*pb.Action {
-	actions := make([]*pb.Action, 0, len(widget))
-	for key, value := range widget {
+func convertActions(widgetActions map[string]action, filter func(action) bool) []*pb.Action {
+	actions := make([]*pb.Action, 0, len(widgetActions))
+	for key, value := range widgetActions {
+		if !filter(value) {
+			continue
+		}
 		actions = append(actions, &pb.Action{Kind: value.kind, Name: key, Path: value.path, QueryNames: value.queryNames})
 	}
 	return actions
 }
+
+func checkResponse(kind pb.MethodKind, templateName string, resData []byte) error {
+	if kind == pb.MethodKind_RAW {
+		if templateName != "" {
+			return errRawWithTemplate
+		}
+		return nil
+	}
+	if len(resData) == 0 {
+		return nil
+	}
+	if !json.Valid(resData) {
+		return errNotJsonData
+	}
+	return checkReservedKeys(resData)
+}
+
+// the walk stops as soon as the limit is exceeded, so the recursion is bounded
+func exceedDepth(value any, limit int) bool {
+	switch casted := value.(type) {
+	case map[string]any:
+		if limit == 0 {
+			return true
+		}
+		for _, elem := range casted {
+			if exceedDepth(elem, limit-1) {
+				return true
+			}
+		}
+	case []any:
+		if limit == 0 {
+			return true
+		}
+		for _, elem := range casted {
+			if exceedDepth(elem, limit-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,377 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var errInternalTest = errors.New("test failure")
+
+func newTestServer(t testing.TB, options ...Option) WidgetServer {
+	t.Helper()
+	return newTestServerWithLogger(t, zap.NewNop(), options...)
+}
+
+// like newTestServer, with the logs recorded
+func newObservedTestServer(t testing.TB, options ...Option) (WidgetServer, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zap.DebugLevel)
+	return newTestServerWithLogger(t, zap.New(core), options...), logs
+}
+
+func newTestServerWithLogger(t testing.TB, logger *zap.Logger, options ...Option) WidgetServer {
+	t.Helper()
+	serverOpts := defaultOptions()
+	for _, option := range options {
+		option(&serverOpts)
+	}
+	s, err := newWidgetServer(serverOpts, otelzap.New(logger), sdktrace.NewTracerProvider())
+	if err != nil {
+		t.Fatalf("failed to create server : %v", err)
+	}
+	t.Cleanup(s.workers.stop)
+	return s
+}
+
+func noopHandler(ctx context.Context, data Data) (string, string, []byte, error) {
+	return "", "", nil, nil
+}
+
+func failingHandler(ctx context.Context, data Data) (string, string, []byte, error) {
+	return "", "", nil, errInternalTest
+}
+
+func panickingHandler(ctx context.Context, data Data) (string, string, []byte, error) {
+	panic("boom")
+}
+
+// collect the header metadata set during a call
+type testTransportStream struct {
+	mutex      sync.Mutex
+	header     metadata.MD
+	headerSent bool
+}
+
+func (s *testTransportStream) Method() string {
+	return "/puzzlewidgetservice.Widget/Process"
+}
+
+func (s *testTransportStream) SetHeader(md metadata.MD) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.headerSent {
+		// like grpc once the first message is sent
+		return errHeaderSent
+	}
+	for key, values := range md {
+		s.header[key] = append(s.header[key], values...)
+	}
+	return nil
+}
+
+func (s *testTransportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *testTransportStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+var errHeaderSent = errors.New("header already sent")
+
+// collect the messages sent during a server streaming call
+type testServerStream struct {
+	transport *testTransportStream
+	ctx       context.Context
+	mutex     sync.Mutex
+	sent      []*pb.ProcessResponse
+}
+
+func newTestServerStream(ctx context.Context) *testServerStream {
+	transport := &testTransportStream{header: metadata.MD{}}
+	return &testServerStream{transport: transport, ctx: grpc.NewContextWithServerTransportStream(ctx, transport)}
+}
+
+func (s *testServerStream) SetHeader(md metadata.MD) error {
+	return s.transport.SetHeader(md)
+}
+
+func (s *testServerStream) SendHeader(md metadata.MD) error {
+	return s.transport.SetHeader(md)
+}
+
+func (s *testServerStream) SetTrailer(md metadata.MD) {
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testServerStream) SendMsg(m any) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.transport.mutex.Lock()
+	s.transport.headerSent = true
+	s.transport.mutex.Unlock()
+
+	// a real stream serializes the message, the server can reuse its buffers
+	s.sent = append(s.sent, proto.Clone(m.(*pb.ProcessResponse)).(*pb.ProcessResponse))
+	return nil
+}
+
+func (s *testServerStream) RecvMsg(m any) error {
+	return io.EOF
+}
+
+// concatenate the Data of the sent messages
+func (s *testServerStream) body() []byte {
+	var body []byte
+	for _, response := range s.sent {
+		body = append(body, response.Data...)
+	}
+	return body
+}
+
+// call Process like the frontend, returning the header metadata set during the call
+func invoke(ctx context.Context, s WidgetServer, widgetName string, actionName string, data Data) (*pb.ProcessResponse, metadata.MD, error) {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stream := &testTransportStream{header: metadata.MD{}}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	response, err := s.Handler().Process(ctx, &pb.ProcessRequest{
+		WidgetName: widgetName, ActionName: actionName, Files: map[string][]byte{dataKey: dataBytes},
+	})
+	return response, stream.header, err
+}
+
+func TestAllActions(t *testing.T) {
+	s := newTestServer(t)
+	first := s.CreateWidget("first")
+	first.AddActionWithQuery("list", pb.MethodKind_GET, "/list", []string{"page"}, noopHandler)
+	first.AddAction("edit", pb.MethodKind_POST, "/edit/:id", noopHandler)
+	s.CreateWidget("second").AddAction("view", pb.MethodKind_GET, "/view", noopHandler)
+	s.CreateWidget("empty")
+
+	tests := []struct {
+		widgetName string
+		want       []ActionInfo
+	}{
+		{widgetName: "first", want: []ActionInfo{
+			{Name: "edit", Kind: pb.MethodKind_POST, Path: "/edit/:id", PathParams: []string{"id"}},
+			{Name: "list", Kind: pb.MethodKind_GET, Path: "/list", QueryNames: []string{"page"}},
+		}},
+		{widgetName: "second", want: []ActionInfo{{Name: "view", Kind: pb.MethodKind_GET, Path: "/view"}}},
+		{widgetName: "empty", want: []ActionInfo{}},
+	}
+
+	all := s.AllActions()
+	if len(all) != len(tests) {
+		t.Errorf("got %d widgets, want %d", len(all), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.widgetName, func(t *testing.T) {
+			if got := all[tt.widgetName]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	all["first"][1].QueryNames[0] = "changed"
+	if queryNames := s.AllActions()["first"][1].QueryNames; queryNames[0] != "page" {
+		t.Errorf("registration changed through AllActions : %v", queryNames)
+	}
+}
+
+func TestPanicMetric(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []Option
+		handler  ActionHandler
+		wantCode codes.Code
+		reason   string
+	}{
+		{
+			name:     "panic",
+			handler:  panickingHandler,
+			wantCode: codes.Internal,
+			reason:   reasonPanic,
+		},
+		{
+			name:     "panic with configured code",
+			options:  []Option{WithPanicStatusCode(codes.Unavailable)},
+			handler:  panickingHandler,
+			wantCode: codes.Unavailable,
+			reason:   reasonPanic,
+		},
+		{
+			name:     "error",
+			handler:  failingHandler,
+			wantCode: codes.Internal,
+			reason:   reasonError,
+		},
+		{
+			name: "status of the package",
+			handler: func(ctx context.Context, data Data) (string, string, []byte, error) {
+				return "", "", nil, fmt.Errorf("limiter : %w", ErrRateLimited)
+			},
+			wantCode: codes.ResourceExhausted,
+			reason:   reasonError,
+		},
+		{
+			name: "status of a downstream service",
+			handler: func(ctx context.Context, data Data) (string, string, []byte, error) {
+				return "", "", nil, status.Error(codes.Unavailable, "database unreachable")
+			},
+			wantCode: codes.Internal,
+			reason:   reasonError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.options...)
+			s.CreateWidget("widget").AddAction("action", pb.MethodKind_GET, "/action", tt.handler)
+
+			_, _, err := invoke(context.Background(), s, "widget", "action", Data{})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("got code %v, want %v", code, tt.wantCode)
+			}
+			for _, reason := range []string{reasonPanic, reasonError} {
+				want := uint64(0)
+				if reason == tt.reason {
+					want = 1
+				}
+				if got := s.metrics.local.errors[errorLabels{widget: "widget", action: "action", reason: reason}]; got != want {
+					t.Errorf("got %d errors with reason %q, want %d", got, reason, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     pb.MethodKind
+		truncate bool
+		resData  string
+		want     string
+		wantCode codes.Code
+	}{
+		{name: "within limit", kind: pb.MethodKind_GET, resData: `{"a":1}`, want: `{"a":1}`},
+		{name: "templated over limit", kind: pb.MethodKind_GET, resData: `{"a":"123456"}`, wantCode: codes.ResourceExhausted},
+		{name: "templated over limit with truncate", kind: pb.MethodKind_GET, truncate: true, resData: `{"a":"123456"}`, wantCode: codes.ResourceExhausted},
+		{name: "raw over limit", kind: pb.MethodKind_RAW, resData: "0123456789", wantCode: codes.ResourceExhausted},
+		{name: "raw over limit with truncate", kind: pb.MethodKind_RAW, truncate: true, resData: "0123456789", want: "01234567"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, WithMaxResponseBytes(8, tt.truncate))
+			s.CreateWidget("widget").AddAction("action", tt.kind, "/action", func(ctx context.Context, data Data) (string, string, []byte, error) {
+				return "", "", []byte(tt.resData), nil
+			})
+
+			response, _, err := invoke(context.Background(), s, "widget", "action", Data{})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("got code %v, want %v", code, tt.wantCode)
+			}
+			if err == nil && string(response.Data) != tt.want {
+				t.Errorf("got %q, want %q", response.Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxDataDepth(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		data  Data
+		want  error
+	}{
+		{name: "no limit", data: Data{"a": []any{Data{"b": []any{1}}}}},
+		{name: "flat", limit: 1, data: Data{"a": 1, "b": "c"}},
+		{name: "at the limit", limit: 3, data: Data{"a": []any{Data{"b": 1}}}},
+		{name: "over the limit with maps", limit: 2, data: Data{"a": Data{"b": Data{"c": 1}}}, want: errDataTooDeep},
+		{name: "over the limit with slices", limit: 2, data: Data{"a": []any{[]any{1}}}, want: errDataTooDeep},
+		{name: "over the limit in a later entry", limit: 2, data: Data{"a": 1, "b": []any{1, []any{2}}}, want: errDataTooDeep},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, WithMaxDataDepth(tt.limit))
+			s.CreateWidget("test").AddAction("submit", pb.MethodKind_POST, "/submit", noopHandler)
+
+			_, _, err := invoke(context.Background(), s, "test", "submit", tt.data)
+			if err != tt.want {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiredFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     Data
+		wantCode codes.Code
+		wantMsg  string
+	}{
+		{name: "all present", data: Data{CurrentUrlKey: "http://site.test/", "tenant": "acme"}},
+		{name: "one missing", data: Data{CurrentUrlKey: "http://site.test/"}, wantCode: codes.InvalidArgument, wantMsg: "missing required field tenant"},
+		{name: "blank", data: Data{CurrentUrlKey: "http://site.test/", "tenant": " "}, wantCode: codes.InvalidArgument, wantMsg: "missing required field tenant"},
+		{name: "all missing", data: Data{}, wantCode: codes.InvalidArgument, wantMsg: "missing required field " + CurrentUrlKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, WithRequiredFields(CurrentUrlKey, "tenant"))
+			s.CreateWidget("test").AddAction("view", pb.MethodKind_GET, "/view", noopHandler)
+
+			_, _, err := invoke(context.Background(), s, "test", "view", tt.data)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("got code %v, want %v", got, tt.wantCode)
+			}
+			if got := status.Convert(err).Message(); tt.wantMsg != "" && got != tt.wantMsg {
+				t.Errorf("got message %q, want %q", got, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// binary header (the values could contain any character)
+const sessionHeader = headerPrefix + "session-bin"
+
+// not reserved (see ReservedKeys) because it is only used in the data passed to the handler
+const sessionUpdatesKey = "puzzlesession.updates"
+
+// Return the session values of the user forwarded by the frontend in the "Session" entry,
+// with the changes made by SetSession (nil when the user has no session values).
+func GetSession(data Data) (Data, error) {
+	return AsMap(data[SessionKey])
+}
+
+// Change a session value of the user (a nil value ask for its removal), the changes
+// are sent back in the response as a json object in the "puzzle-session-bin" header metadata
+// and the frontend is expected to merge them in the session of the user, in order to find them
+// in the "Session" entry of the following calls.
+func SetSession(data Data, key string, value any) error {
+	session, err := GetSession(data)
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		session = Data{}
+		data[SessionKey] = session
+	}
+	if value == nil {
+		delete(session, key)
+	} else {
+		session[key] = value
+	}
+
+	updates, _ := data[sessionUpdatesKey].(Data)
+	if updates == nil {
+		updates = Data{}
+		data[sessionUpdatesKey] = updates
+	}
+	updates[key] = value
+	return nil
+}
+
+func sendSessionUpdates(ctx context.Context, data Data) error {
+	updates, _ := data[sessionUpdatesKey].(Data)
+	if len(updates) == 0 {
+		return nil
+	}
+	updatesBytes, err := json.Marshal(updates)
+	if err != nil {
+		return err
+	}
+	return grpc.SetHeader(ctx, metadata.Pairs(sessionHeader, string(updatesBytes)))
+}
@@ -0,0 +1,199 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+type lifecycle struct {
+	mutex         sync.Mutex
+	startCallback []func(context.Context) error
+	stopCallback  []func(context.Context) error
+	shutdownOnce  sync.Once
+	shutdownErr   error
+}
+
+// Maximum time given to the in-flight calls to finish when the context of
+// StartWithContext is done (default to 30 seconds).
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(o *serverOptions) {
+		o.shutdownTimeout = timeout
+	}
+}
+
+// Register an initialization callback (opening a database pool, a grpc client connection, etc.)
+// called by StartWithContext before serving, in registration order. The first failing callback
+// stops the start, the server is then shut down (see Shutdown) and the error is returned.
+func (s WidgetServer) OnStart(callback func(context.Context) error) {
+	s.lifecycle.mutex.Lock()
+	defer s.lifecycle.mutex.Unlock()
+
+	s.lifecycle.startCallback = append(s.lifecycle.startCallback, callback)
+}
+
+// Register a cleanup callback called by Shutdown once the in-flight calls are drained,
+// the callbacks are called in reverse registration order.
+func (s WidgetServer) OnStop(callback func(context.Context) error) {
+	s.lifecycle.mutex.Lock()
+	defer s.lifecycle.mutex.Unlock()
+
+	s.lifecycle.stopCallback = append(s.lifecycle.stopCallback, callback)
+}
+
+// Close closer during Shutdown, like a callback registered with OnStop.
+func (s WidgetServer) RegisterCloser(closer io.Closer) {
+	s.OnStop(func(context.Context) error {
+		return closer.Close()
+	})
+}
+
+// Serve until ctx is done or until Shutdown is called, the server is shut down (with the configured
+// timeout) on every exit and the returned error comes from the start callbacks, serving or the shutdown.
+func (s WidgetServer) StartWithContext(ctx context.Context) error {
+	s.lifecycle.mutex.Lock()
+	startCallbacks := s.lifecycle.startCallback
+	s.lifecycle.mutex.Unlock()
+	for _, callback := range startCallbacks {
+		if err := callback(ctx); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to run start callback", zap.Error(err))
+			return errors.Join(err, s.shutdownWithTimeout())
+		}
+	}
+
+	s.registry.warmResponses(s.options.trailingSlash)
+	adapter := s.adapter()
+	pb.RegisterWidgetServer(s.grpcServer, adapter)
+	s.grpcServer.RegisterService(&widgetStreamServiceDesc, adapter)
+	s.startObservability()
+	s.registry.scheduler.start()
+	go s.health.watch(s.options.healthCheckInterval, s.logger)
+
+	_, startSpan := s.tracer.Start(ctx, "start")
+	s.logger.InfoContext(ctx, "Listening", zap.String("address", s.listener.Addr().String()))
+	serveErr := make(chan error, 1)
+	go func() {
+		err := s.grpcServer.Serve(s.listener)
+		if err == grpc.ErrServerStopped {
+			// Shutdown was called before Serve
+			err = nil
+		}
+		serveErr <- err
+	}()
+
+	var err error
+	select {
+	case err = <-serveErr:
+		startSpan.End()
+		err = errors.Join(err, s.shutdownWithTimeout())
+	case <-ctx.Done():
+		startSpan.End()
+		err = s.shutdownWithTimeout()
+		if err2 := <-serveErr; err2 != nil {
+			err = errors.Join(err2, err)
+		}
+	}
+	return err
+}
+
+func (s WidgetServer) shutdownWithTimeout() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.options.shutdownTimeout)
+	defer cancel()
+
+	return s.Shutdown(ctx)
+}
+
+// Report NOT_SERVING on the health service, stop accepting calls and wait for the in-flight ones
+// until ctx is done (the remaining calls are then cancelled), stop the worker pool, cancel the async jobs
+// and the scheduled tasks and wait for them (also until ctx is done), stop the side endpoints,
+// call the callbacks registered with OnStop and flush the traces.
+//
+// Only the first call does the work, the following ones return the same result.
+func (s WidgetServer) Shutdown(ctx context.Context) error {
+	s.lifecycle.shutdownOnce.Do(func() {
+		s.lifecycle.shutdownErr = s.shutdown(ctx)
+	})
+	return s.lifecycle.shutdownErr
+}
+
+func (s WidgetServer) shutdown(ctx context.Context) error {
+	ctx, stopSpan := s.tracer.Start(ctx, "shutdown")
+	defer stopSpan.End()
+
+	// readiness probes see the server leaving before the calls are drained
+	s.health.stop()
+
+	drained := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		s.logger.WarnContext(ctx, "Shutdown timeout reached, cancelling in-flight calls")
+		s.grpcServer.Stop()
+		<-drained
+	}
+
+	var errs []error
+	s.workers.stop()
+	if err := s.registry.jobs.stop(ctx); err != nil {
+		s.logger.WarnContext(ctx, "Shutdown timeout reached, abandoning running async jobs")
+		errs = append(errs, err)
+	}
+	if err := s.registry.scheduler.stop(ctx); err != nil {
+		s.logger.WarnContext(ctx, "Shutdown timeout reached, abandoning running scheduled tasks")
+		errs = append(errs, err)
+	}
+
+	if s.observability != nil {
+		if ctx.Err() == nil {
+			errs = append(errs, s.observability.Shutdown(ctx))
+		} else {
+			errs = append(errs, s.observability.Close())
+		}
+	}
+
+	s.lifecycle.mutex.Lock()
+	callbacks := s.lifecycle.stopCallback
+	s.lifecycle.mutex.Unlock()
+	for i := len(callbacks) - 1; i >= 0; i-- {
+		if err := callbacks[i](ctx); err != nil {
+			s.logger.WarnContext(ctx, "Failed to run stop callback", zap.Error(err))
+			errs = append(errs, err)
+		}
+	}
+
+	if err := s.tracerProvider.Shutdown(ctx); err != nil {
+		s.logger.WarnContext(ctx, "Failed to shutdown trace provider", zap.Error(err))
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+var errStartTest = errors.New("start failure")
+
+type failingListener struct {
+	net.Listener
+}
+
+func (l failingListener) Accept() (net.Conn, error) {
+	return nil, errors.New("accept failure")
+}
+
+func TestStartWithContextShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		start   func(context.Context) error
+		failing bool
+		cancel  bool
+		wantErr bool
+	}{
+		{name: "context done", cancel: true},
+		{name: "start callback failure", start: func(context.Context) error { return errStartTest }, wantErr: true},
+		{name: "serve failure", failing: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, WithShutdownTimeout(time.Second))
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen : %v", err)
+			}
+			s.listener = listener
+			if tt.failing {
+				s.listener = failingListener{Listener: listener}
+				defer listener.Close()
+			}
+			if tt.start != nil {
+				s.OnStart(tt.start)
+			}
+			stopped := make(chan struct{})
+			s.OnStop(func(context.Context) error {
+				close(stopped)
+				return nil
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				done <- s.StartWithContext(ctx)
+			}()
+			if tt.cancel {
+				cancel()
+			}
+
+			select {
+			case err = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("StartWithContext did not return")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+			select {
+			case <-stopped:
+			default:
+				t.Error("stop callback not called")
+			}
+		})
+	}
+}
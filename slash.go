@@ -0,0 +1,51 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import "strings"
+
+const trailingSlashHeader = headerPrefix + "trailing-slash"
+
+// Indicate to the frontend router how to handle a trailing slash on action paths.
+type TrailingSlashMode string
+
+const (
+	// paths are matched exactly as registered (the default)
+	TrailingSlashStrict TrailingSlashMode = "strict"
+	// paths are registered without trailing slash and the variant with one is redirected
+	TrailingSlashRedirect TrailingSlashMode = "redirect"
+	// paths are registered without trailing slash and both variants are served
+	TrailingSlashTolerant TrailingSlashMode = "tolerant"
+)
+
+// Set the trailing slash handling, with a mode other than TrailingSlashStrict, action paths are
+// sent without their trailing slash by GetWidget and the mode is sent in the "puzzle-trailing-slash"
+// header metadata of the GetWidget response.
+func WithTrailingSlash(mode TrailingSlashMode) Option {
+	return func(o *serverOptions) {
+		o.trailingSlash = mode
+	}
+}
+
+func normalizePath(mode TrailingSlashMode, path string) string {
+	if mode == TrailingSlashStrict || len(path) < 2 {
+		return path
+	}
+	return strings.TrimSuffix(path, "/")
+}
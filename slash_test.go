@@ -0,0 +1,80 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		mode TrailingSlashMode
+		path string
+		want string
+	}{
+		{mode: TrailingSlashStrict, path: "/list/", want: "/list/"},
+		{mode: TrailingSlashStrict, path: "/list", want: "/list"},
+		{mode: TrailingSlashRedirect, path: "/list/", want: "/list"},
+		{mode: TrailingSlashRedirect, path: "/list", want: "/list"},
+		{mode: TrailingSlashTolerant, path: "/list/", want: "/list"},
+		{mode: TrailingSlashTolerant, path: "/", want: "/"},
+		{mode: TrailingSlashTolerant, path: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := normalizePath(tt.mode, tt.path); got != tt.want {
+			t.Errorf("normalizePath(%q, %q) = %q, want %q", tt.mode, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGetWidgetTrailingSlash(t *testing.T) {
+	tests := []struct {
+		mode       TrailingSlashMode
+		wantPath   string
+		wantHeader []string
+	}{
+		{mode: TrailingSlashStrict, wantPath: "/list/"},
+		{mode: TrailingSlashRedirect, wantPath: "/list", wantHeader: []string{"redirect"}},
+		{mode: TrailingSlashTolerant, wantPath: "/list", wantHeader: []string{"tolerant"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			s := newTestServer(t, WithTrailingSlash(tt.mode))
+			s.CreateWidget("test").AddAction("list", pb.MethodKind_GET, "/list/", noopHandler)
+
+			stream := &testTransportStream{header: metadata.MD{}}
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+			response, err := s.Handler().GetWidget(ctx, &pb.WidgetRequest{Name: "test"})
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if len(response.Actions) != 1 || response.Actions[0].Path != tt.wantPath {
+				t.Errorf("got actions %v, want path %q", response.Actions, tt.wantPath)
+			}
+			if got := stream.header.Get(trailingSlashHeader); len(got) != len(tt.wantHeader) || (len(got) != 0 && got[0] != tt.wantHeader[0]) {
+				t.Errorf("got header %v, want %v", got, tt.wantHeader)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+// Machine readable description of the registered widgets (json serializable),
+// usable to configure a gateway or to generate client code.
+type Spec struct {
+	Widgets []WidgetSpec `json:"widgets"`
+}
+
+type WidgetSpec struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Actions     []ActionSpec `json:"actions"`
+}
+
+type ActionSpec struct {
+	Name           string   `json:"name"`
+	Kind           string   `json:"kind"`
+	Path           string   `json:"path"`
+	QueryNames     []string `json:"queryNames,omitempty"`
+	PathParams     []string `json:"pathParams,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	RequiredParams []string `json:"requiredParams,omitempty"`
+}
+
+// Build a Spec from the registered widgets, widgets and actions are sorted by name.
+func (s WidgetServer) ExportSpec() Spec {
+	return buildSpec(s.Widgets())
+}
+
+func buildSpec(infos []WidgetInfo) Spec {
+	widgets := make([]WidgetSpec, 0, len(infos))
+	for _, info := range infos {
+		actions := make([]ActionSpec, 0, len(info.Actions))
+		for _, actionInfo := range info.Actions {
+			actions = append(actions, ActionSpec{
+				Name: actionInfo.Name, Kind: actionInfo.Kind.String(), Path: actionInfo.Path, QueryNames: actionInfo.QueryNames,
+				PathParams: actionInfo.PathParams, Description: actionInfo.Description, RequiredParams: actionInfo.RequiredParams,
+			})
+		}
+		widgets = append(widgets, WidgetSpec{Name: info.Name, Description: info.Description, Actions: actions})
+	}
+	return Spec{Widgets: widgets}
+}
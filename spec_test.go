@@ -0,0 +1,66 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+func TestExportSpec(t *testing.T) {
+	s := newTestServer(t)
+	users := s.CreateWidget("users")
+	users.SetDescription("User management")
+	users.AddActionWithInfo("view", pb.MethodKind_GET, "/view/:id", []string{"tab"}, "Show a user", []string{"pathData/id"}, noopHandler)
+	users.AddAction("delete", pb.MethodKind_DELETE, "/delete/:id", noopHandler)
+	s.CreateWidget("blog").AddActionWithQuery("list", pb.MethodKind_GET, "/list", []string{"pageNumber", "pageSize"}, noopHandler)
+
+	want := Spec{Widgets: []WidgetSpec{
+		{Name: "blog", Actions: []ActionSpec{
+			{Name: "list", Kind: "GET", Path: "/list", QueryNames: []string{"pageNumber", "pageSize"}},
+		}},
+		{Name: "users", Description: "User management", Actions: []ActionSpec{
+			{Name: "delete", Kind: "DELETE", Path: "/delete/:id", PathParams: []string{"id"}},
+			{
+				Name: "view", Kind: "GET", Path: "/view/:id", QueryNames: []string{"tab"}, PathParams: []string{"id"},
+				Description: "Show a user", RequiredParams: []string{"pathData/id"},
+			},
+		}},
+	}}
+
+	got := s.ExportSpec()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	specBytes, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("failed to marshal spec : %v", err)
+	}
+	var decoded Spec
+	if err = json.Unmarshal(specBytes, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal spec : %v", err)
+	}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("json round trip gives %+v, want %+v", decoded, want)
+	}
+}
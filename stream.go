@@ -0,0 +1,247 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc"
+)
+
+// Full name of the server streaming variant of Process : it takes the same pb.ProcessRequest
+// and answers with a stream of pb.ProcessResponse, the first one carries the redirect and the
+// template name, the Data of all of them must be concatenated.
+// An error can arrive after some chunks, the received data must then be dropped.
+const ProcessStreamMethod = "/puzzlewidgetservice.WidgetStream/ProcessStream"
+
+const streamChunkSize = 64 * 1024
+
+var errStreamClosed = errors.New("stream already closed")
+
+// StreamHandler write the body of a RAW action, the headers (see SetResponseHeader, and SetCacheControl,
+// AddFlash or SetSession whose headers are sent just before the first chunk) must be set before the first write.
+type StreamHandler = func(context.Context, Data, io.Writer) error
+
+// Full name of the client streaming variant of Process, for large uploads : the first pb.ProcessRequest
+// carries the widget and action names with the "puzzledata.json" entry in Files (and optionally a
+// "puzzlefiles.json" entry, a json object associating file names to their "filename" and "contentType"),
+// the Files of the following messages are chunks appended to the file with the same name.
+// The answer is a single pb.ProcessResponse, the handler reads the files with GetFileParts.
+const UploadMethod = "/puzzlewidgetservice.WidgetStream/Upload"
+
+// what the streaming service pass to process
+type streamCall struct {
+	out   *chunkWriter
+	parts map[string]FilePart
+	// already unmarshalled and with the access checked (see Upload)
+	data Data
+	// action slot already acquired (see WithMaxConcurrentActions)
+	reserved bool
+}
+
+type widgetStreamServer interface {
+	ProcessStream(*pb.ProcessRequest, grpc.ServerStream) error
+	Upload(grpc.ServerStream) error
+}
+
+var widgetStreamServiceDesc = grpc.ServiceDesc{
+	ServiceName: "puzzlewidgetservice.WidgetStream",
+	HandlerType: (*widgetStreamServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "ProcessStream", Handler: processStreamHandler, ServerStreams: true,
+	}, {
+		StreamName: "Upload", Handler: uploadHandler, ClientStreams: true,
+	}},
+	Metadata: "puzzlewidgetserver",
+}
+
+func processStreamHandler(srv any, stream grpc.ServerStream) error {
+	request := new(pb.ProcessRequest)
+	if err := stream.RecvMsg(request); err != nil {
+		return err
+	}
+	return srv.(widgetStreamServer).ProcessStream(request, stream)
+}
+
+func uploadHandler(srv any, stream grpc.ServerStream) error {
+	return srv.(widgetStreamServer).Upload(stream)
+}
+
+// Register a RAW action whose body is written by handler : called with ProcessStreamMethod the
+// output is sent in chunks as it is written (without deduplication, size limit or compression),
+// called with Process it is buffered in memory.
+func (w Widget) AddStreamAction(actionName string, path string, queryNames []string, handler StreamHandler, opts ...ActionOption) {
+	w.addAction(actionName, action{
+		kind: pb.MethodKind_RAW, path: path, queryNames: queryNames, handler: bufferedHandler(handler), stream: handler,
+	}, opts)
+}
+
+func bufferedHandler(handler StreamHandler) ActionHandler {
+	return func(ctx context.Context, data Data) (string, string, []byte, error) {
+		var buffer bytes.Buffer
+		if err := handler(ctx, data, &buffer); err != nil {
+			return "", "", nil, err
+		}
+		return "", "", buffer.Bytes(), nil
+	}
+}
+
+func streamingHandler(handler StreamHandler, out io.Writer) ActionHandler {
+	return func(ctx context.Context, data Data) (string, string, []byte, error) {
+		return "", "", nil, handler(ctx, data, out)
+	}
+}
+
+func (s widgetServerAdapter) ProcessStream(request *pb.ProcessRequest, stream grpc.ServerStream) error {
+	writer := &chunkWriter{stream: stream}
+	defer writer.close()
+
+	response, err := s.process(stream.Context(), request, &streamCall{out: writer})
+	if err != nil {
+		return err
+	}
+	if err = writer.flush(); err != nil {
+		return err
+	}
+	if response.Redirect == "" && response.TemplateName == "" && len(response.Data) == 0 {
+		return nil
+	}
+
+	// output of an action without stream handler
+	first := &pb.ProcessResponse{Redirect: response.Redirect, TemplateName: response.TemplateName}
+	resData := response.Data
+	if len(resData) > streamChunkSize {
+		first.Data, resData = resData[:streamChunkSize], resData[streamChunkSize:]
+	} else {
+		first.Data, resData = resData, nil
+	}
+	if err = writer.send(first); err != nil {
+		return err
+	}
+	for len(resData) != 0 {
+		chunk := resData
+		if len(chunk) > streamChunkSize {
+			chunk = chunk[:streamChunkSize]
+		}
+		if err = writer.send(&pb.ProcessResponse{Data: chunk}); err != nil {
+			return err
+		}
+		resData = resData[len(chunk):]
+	}
+	return nil
+}
+
+// buffer the writes to send chunks of streamChunkSize, the mutex and the closed flag protect
+// the stream from an handler still writing after a timeout
+type chunkWriter struct {
+	mutex  sync.Mutex
+	stream grpc.ServerStream
+	buffer []byte
+	closed bool
+	// called once before the first chunk
+	headerSender func()
+}
+
+func (w *chunkWriter) setHeaderSender(headerSender func()) {
+	w.mutex.Lock()
+	w.headerSender = headerSender
+	w.mutex.Unlock()
+}
+
+// send the headers if no chunk was sent
+func (w *chunkWriter) writeHeader() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.sendHeader()
+}
+
+// the caller must hold the mutex
+func (w *chunkWriter) sendHeader() {
+	if headerSender := w.headerSender; headerSender != nil {
+		w.headerSender = nil
+		headerSender()
+	}
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return 0, errStreamClosed
+	}
+	if w.buffer == nil {
+		w.buffer = getPooledChunk()
+	}
+	written := len(p)
+	for len(w.buffer)+len(p) >= streamChunkSize {
+		missing := streamChunkSize - len(w.buffer)
+		w.buffer = append(w.buffer, p[:missing]...)
+		p = p[missing:]
+		w.sendHeader()
+		if err := w.stream.SendMsg(&pb.ProcessResponse{Data: w.buffer}); err != nil {
+			return written - len(p), err
+		}
+		w.buffer = w.buffer[:0]
+	}
+	w.buffer = append(w.buffer, p...)
+	return written, nil
+}
+
+func (w *chunkWriter) flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed || len(w.buffer) == 0 {
+		return nil
+	}
+	w.sendHeader()
+	err := w.stream.SendMsg(&pb.ProcessResponse{Data: w.buffer})
+	w.buffer = w.buffer[:0]
+	return err
+}
+
+func (w *chunkWriter) send(response *pb.ProcessResponse) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errStreamClosed
+	}
+	w.sendHeader()
+	return w.stream.SendMsg(response)
+}
+
+func (w *chunkWriter) close() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.closed = true
+	if w.buffer != nil {
+		// SendMsg has serialized the chunks, the buffer can be reused
+		putPooledChunk(w.buffer)
+		w.buffer = nil
+	}
+}
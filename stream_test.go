@@ -0,0 +1,145 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+// call ProcessStream like the frontend
+func invokeStream(ctx context.Context, s WidgetServer, widgetName string, actionName string, data Data) (*testServerStream, error) {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := newTestServerStream(ctx)
+	err = s.adapter().ProcessStream(&pb.ProcessRequest{
+		WidgetName: widgetName, ActionName: actionName, Files: map[string][]byte{dataKey: dataBytes},
+	}, stream)
+	return stream, err
+}
+
+func TestProcessStreamBypass(t *testing.T) {
+	body := strings.Repeat("streamed line\n", 100)
+	var calls atomic.Int32
+	handler := func(ctx context.Context, data Data, out io.Writer) error {
+		calls.Add(1)
+		_, err := io.WriteString(out, body)
+		return err
+	}
+
+	tests := []struct {
+		name      string
+		options   []Option
+		opts      []ActionOption
+		wantCalls int32
+	}{
+		{name: "deduplicated", opts: []ActionOption{Deduplicated(time.Minute)}, wantCalls: 2},
+		{name: "size limit", options: []Option{WithMaxResponseBytes(10, false)}, wantCalls: 2},
+		{name: "compression", options: []Option{WithResponseCompression(1)}, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			s := newTestServer(t, tt.options...)
+			s.CreateWidget("test").AddStreamAction("export", "/export", nil, handler, tt.opts...)
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(acceptCompressionHeader, gzipCompression))
+			for i := 0; i < 2; i++ {
+				stream, err := invokeStream(ctx, s, "test", "export", Data{UserIdKey: 3})
+				if err != nil {
+					t.Fatalf("unexpected error : %v", err)
+				}
+				if got := string(stream.body()); got != body {
+					t.Errorf("got a body of %d bytes, want %d", len(got), len(body))
+				}
+				if got := stream.transport.header.Get("puzzle-data-compression"); len(got) != 0 {
+					t.Errorf("got compression header %v on a streamed body", got)
+				}
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("got %d calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestProcessStreamHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "short body", size: 10},
+		{name: "several chunks", size: 3 * streamChunkSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, logs := newObservedTestServer(t)
+			s.CreateWidget("test").AddStreamAction("export", "/export", nil, func(ctx context.Context, data Data, out io.Writer) error {
+				SetCacheControl(ctx, time.Minute, true)
+				AddFlash(data, "info", "exported")
+				_, err := io.WriteString(out, strings.Repeat("a", tt.size))
+				return err
+			})
+
+			stream, err := invokeStream(context.Background(), s, "test", "export", Data{})
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if got := len(stream.body()); got != tt.size {
+				t.Errorf("got a body of %d bytes, want %d", got, tt.size)
+			}
+			if got := stream.transport.header.Get("puzzle-cache-control"); len(got) != 1 || got[0] != "private, max-age=60" {
+				t.Errorf("got cache control header %v", got)
+			}
+			if got := stream.transport.header.Get(flashHeader); len(got) != 1 {
+				t.Errorf("got flash header %v", got)
+			}
+			if warnings := logs.FilterLevelExact(zap.WarnLevel).All(); len(warnings) != 0 {
+				t.Errorf("unexpected warnings : %v", warnings)
+			}
+		})
+	}
+}
+
+func TestProcessStreamEmptyBodyHeaders(t *testing.T) {
+	s := newTestServer(t)
+	s.CreateWidget("test").AddStreamAction("export", "/export", nil, func(ctx context.Context, data Data, out io.Writer) error {
+		return nil
+	})
+
+	stream, err := invokeStream(context.Background(), s, "test", "export", Data{})
+	if err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	if got := stream.transport.header.Get("puzzle-cache-control"); len(got) != 1 || got[0] != noCacheDirective {
+		t.Errorf("got cache control header %v", got)
+	}
+}
@@ -0,0 +1,53 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const actionSpanName = "widget.action"
+
+// the span of the handler processing step, child of the one of the grpc call
+func startActionSpan(ctx context.Context, tracer trace.Tracer, widgetName string, actionName string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, actionSpanName, trace.WithAttributes(
+		attribute.String("widgetName", widgetName), attribute.String("actionName", actionName),
+	))
+}
+
+func setSpanUserId(span trace.Span, data Data) {
+	if userId, err := GetCurrentUserId(data); err == nil {
+		span.SetAttributes(attribute.Int64("userId", int64(userId)))
+	}
+}
+
+func endActionSpan(span trace.Span, response *pb.ProcessResponse, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	} else if response != nil {
+		span.SetAttributes(attribute.String("redirect", response.Redirect), attribute.String("templateName", response.TemplateName))
+	}
+	span.End()
+}
@@ -0,0 +1,64 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+// A typed response implementing Redirecter trigger a redirect when RedirectUrl returns a non empty string.
+type Redirecter interface {
+	RedirectUrl() string
+}
+
+// Register an action whose handler works on typed values : the call data are decoded into a Req
+// with Bind (so the form is reachable with a nested struct field tagged `form:"formData"`
+// and path parameters with tags like `form:"pathData/id"`), and the Resp is marshalled in json
+// (passed to templateName, which is ignored for RAW actions).
+func AddTypedAction[Req any, Resp any](w Widget, actionName string, kind pb.MethodKind, path string, templateName string, handler func(context.Context, Req) (Resp, error), opts ...ActionOption) {
+	if kind == pb.MethodKind_RAW {
+		templateName = ""
+	}
+	w.AddAction(actionName, kind, path, func(ctx context.Context, data Data) (string, string, []byte, error) {
+		var request Req
+		if err := Bind(data, &request); err != nil {
+			return "", "", nil, err
+		}
+
+		response, err := handler(ctx, request)
+		if err != nil {
+			return "", "", nil, err
+		}
+
+		if redirecter, ok := any(response).(Redirecter); ok {
+			if redirect := redirecter.RedirectUrl(); redirect != "" {
+				return redirect, "", nil, nil
+			}
+		}
+
+		resData, err := json.Marshal(response)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return "", templateName, resData, nil
+	}, opts...)
+}
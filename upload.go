@@ -0,0 +1,296 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const fileInfosKey = "puzzlefiles.json"
+
+var errFilePartsType = errors.New("field FileParts is not of the expected type")
+
+const defaultMaxUploadSize = 1 << 30
+const defaultMaxUploadParts = 32
+
+// Returned to the frontend when a file exceeds the limit set with WithMaxFileSize or MaxFileSize.
+var ErrFileTooLarge = status.Error(codes.InvalidArgument, "file too large")
+
+// Returned to the frontend when an Upload call exceeds the limits set with WithUploadLimits.
+var ErrUploadTooLarge = status.Error(codes.InvalidArgument, "upload too large")
+var ErrTooManyParts = status.Error(codes.InvalidArgument, "too many uploaded files")
+
+// File received by an action, from the Files of a Process call (in memory, without
+// Filename nor ContentType) or from an Upload call (stored in a temporary file
+// removed once the handler returns).
+type FilePart struct {
+	Name        string
+	Filename    string
+	ContentType string
+	Size        int64
+	content     []byte
+	path        string
+}
+
+// The caller must close the returned reader.
+func (p FilePart) Open() (io.ReadCloser, error) {
+	if p.path == "" {
+		return io.NopCloser(bytes.NewReader(p.content)), nil
+	}
+	return os.Open(p.path)
+}
+
+// Read the whole file in memory (avoid it for large uploads).
+func (p FilePart) ReadAll() ([]byte, error) {
+	if p.path == "" {
+		return p.content, nil
+	}
+	return os.ReadFile(p.path)
+}
+
+type fileInfo struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+}
+
+// Override for the action the file size limit of the server (see WithMaxFileSize).
+func MaxFileSize(limit int64) ActionOption {
+	return func(a *action) {
+		a.maxFileSize = limit
+	}
+}
+
+// Limit the total size in bytes and the number of the files received by an Upload call
+// (default to 1GB and 32 files, zero means no limit).
+func WithUploadLimits(maxSize int64, maxParts int) Option {
+	return func(o *serverOptions) {
+		o.maxUploadSize = maxSize
+		o.maxUploadParts = maxParts
+	}
+}
+
+func fileSizeLimit(a action, serverLimit int64) int64 {
+	if a.maxFileSize > 0 {
+		return a.maxFileSize
+	}
+	return serverLimit
+}
+
+func exceedFileSize(files map[string][]byte, parts map[string]FilePart, limit int64) bool {
+	if limit <= 0 {
+		return false
+	}
+	for _, content := range files {
+		if int64(len(content)) > limit {
+			return true
+		}
+	}
+	for _, part := range parts {
+		if part.Size > limit {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the files of the call indexed by name, whatever the way they were sent.
+func GetFileParts(data Data) (map[string]FilePart, error) {
+	files, err := GetFiles(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var uploaded map[string]FilePart
+	if value := data[FilePartsKey]; value != nil {
+		var ok bool
+		if uploaded, ok = value.(map[string]FilePart); !ok {
+			return nil, errFilePartsType
+		}
+	}
+
+	parts := make(map[string]FilePart, len(files)+len(uploaded))
+	for name, content := range files {
+		parts[name] = FilePart{Name: name, Size: int64(len(content)), content: content}
+	}
+	for name, part := range uploaded {
+		parts[name] = part
+	}
+	return parts, nil
+}
+
+// the access to the action is checked and the action slot (see WithMaxConcurrentActions) acquired
+// with the first message, before receiving any file
+func (s widgetServerAdapter) Upload(stream grpc.ServerStream) error {
+	ctx := contextWithRequestId(stream.Context())
+
+	request := new(pb.ProcessRequest)
+	if err := stream.RecvMsg(request); err != nil {
+		return err
+	}
+	action, _, err := s.getAction(request.WidgetName, request.ActionName)
+	if err != nil {
+		return err
+	}
+
+	if !acquireActionSlot(s.options.actionSlots) {
+		s.metrics.recordError(ctx, request.WidgetName, request.ActionName, reasonOverloaded)
+		return ErrOverloaded
+	}
+	defer releaseActionSlot(s.options.actionSlots)
+
+	var data Data
+	if err = s.options.codec.Unmarshal(request.Files[dataKey], &data); err != nil {
+		return status.Error(codes.InvalidArgument, "invalid "+dataKey)
+	}
+	if data == nil {
+		data = Data{}
+	}
+	ctx, response, err := s.checkAccess(ctx, action, data)
+	if err != nil {
+		return err
+	}
+	if response != nil {
+		return stream.SendMsg(response)
+	}
+
+	var infos map[string]fileInfo
+	if infosBytes, ok := request.Files[fileInfosKey]; ok {
+		if err := json.Unmarshal(infosBytes, &infos); err != nil {
+			return status.Error(codes.InvalidArgument, "invalid "+fileInfosKey)
+		}
+		delete(request.Files, fileInfosKey)
+	}
+
+	dir, err := os.MkdirTemp("", "puzzleupload")
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to create upload directory", requestIdField(ctx), zap.Error(err))
+		return s.internalError(ctx)
+	}
+	defer os.RemoveAll(dir)
+
+	receiver := &uploadReceiver{
+		dir: dir, infos: infos, limit: fileSizeLimit(action, s.options.maxFileSize),
+		totalLimit: s.options.maxUploadSize, partsLimit: s.options.maxUploadParts,
+		parts: map[string]FilePart{}, files: map[string]*os.File{},
+	}
+	defer receiver.closeFiles()
+
+	// chunks sent along with the data
+	for name, chunk := range request.Files {
+		if name == dataKey {
+			continue
+		}
+		if err = s.receive(ctx, receiver, name, chunk); err != nil {
+			return err
+		}
+		delete(request.Files, name)
+	}
+
+	for {
+		chunkRequest := new(pb.ProcessRequest)
+		if err = stream.RecvMsg(chunkRequest); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		for name, chunk := range chunkRequest.Files {
+			if err = s.receive(ctx, receiver, name, chunk); err != nil {
+				return err
+			}
+		}
+	}
+	receiver.closeFiles()
+
+	response, err = s.process(ctx, request, &streamCall{parts: receiver.parts, data: data, reserved: true})
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(response)
+}
+
+func (s widgetServerAdapter) receive(ctx context.Context, receiver *uploadReceiver, name string, chunk []byte) error {
+	err := receiver.write(name, chunk)
+	if err == nil || err == ErrFileTooLarge || err == ErrUploadTooLarge || err == ErrTooManyParts {
+		return err
+	}
+	s.logger.ErrorContext(ctx, "Failed to store upload", requestIdField(ctx), zap.Error(err))
+	return s.internalError(ctx)
+}
+
+type uploadReceiver struct {
+	dir        string
+	infos      map[string]fileInfo
+	limit      int64
+	totalLimit int64
+	partsLimit int
+	total      int64
+	parts      map[string]FilePart
+	files      map[string]*os.File
+}
+
+func (r *uploadReceiver) write(name string, chunk []byte) error {
+	// stop before storing more than the limits
+	r.total += int64(len(chunk))
+	if r.totalLimit > 0 && r.total > r.totalLimit {
+		return ErrUploadTooLarge
+	}
+
+	file, ok := r.files[name]
+	if !ok {
+		if r.partsLimit > 0 && len(r.parts) >= r.partsLimit {
+			return ErrTooManyParts
+		}
+		var err error
+		if file, err = os.CreateTemp(r.dir, "part"); err != nil {
+			return err
+		}
+		r.files[name] = file
+		info := r.infos[name]
+		r.parts[name] = FilePart{Name: name, Filename: info.Filename, ContentType: info.ContentType, path: file.Name()}
+	}
+
+	part := r.parts[name]
+	part.Size += int64(len(chunk))
+	if r.limit > 0 && part.Size > r.limit {
+		return ErrFileTooLarge
+	}
+	if _, err := file.Write(chunk); err != nil {
+		return err
+	}
+	r.parts[name] = part
+	return nil
+}
+
+func (r *uploadReceiver) closeFiles() {
+	for name, file := range r.files {
+		file.Close()
+		delete(r.files, name)
+	}
+}
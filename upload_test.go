@@ -0,0 +1,96 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/protobuf/proto"
+)
+
+// replay the messages of a client streaming call
+type testUploadStream struct {
+	*testServerStream
+	requests []*pb.ProcessRequest
+	received int
+}
+
+func (s *testUploadStream) RecvMsg(m any) error {
+	if s.received == len(s.requests) {
+		return io.EOF
+	}
+	proto.Merge(m.(*pb.ProcessRequest), s.requests[s.received])
+	s.received++
+	return nil
+}
+
+func newTestUploadStream(t *testing.T, widgetName string, actionName string, data Data, chunks ...map[string][]byte) *testUploadStream {
+	t.Helper()
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []*pb.ProcessRequest{{WidgetName: widgetName, ActionName: actionName, Files: map[string][]byte{dataKey: dataBytes}}}
+	for _, chunk := range chunks {
+		requests = append(requests, &pb.ProcessRequest{Files: chunk})
+	}
+	return &testUploadStream{testServerStream: newTestServerStream(context.Background()), requests: requests}
+}
+
+func TestUpload(t *testing.T) {
+	s := newTestServer(t)
+	s.CreateWidget("test").AddAction("upload", pb.MethodKind_POST, "/upload", func(ctx context.Context, data Data) (string, string, []byte, error) {
+		parts, err := GetFileParts(data)
+		if err != nil {
+			return "", "", nil, err
+		}
+		content, err := parts["file"].ReadAll()
+		return "", "", content, err
+	})
+
+	stream := newTestUploadStream(t, "test", "upload", Data{}, map[string][]byte{"file": []byte("hello ")}, map[string][]byte{"file": []byte("world")})
+	if err := s.adapter().Upload(stream); err != nil {
+		t.Fatalf("unexpected error : %v", err)
+	}
+	if got := string(stream.body()); got != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+}
+
+func TestUploadOverloaded(t *testing.T) {
+	s := newTestServer(t, WithMaxConcurrentActions(1))
+	s.CreateWidget("test").AddAction("upload", pb.MethodKind_POST, "/upload", noopHandler)
+
+	// a call in progress holds the only slot
+	acquireActionSlot(s.options.actionSlots)
+	defer releaseActionSlot(s.options.actionSlots)
+
+	stream := newTestUploadStream(t, "test", "upload", Data{}, map[string][]byte{"file": []byte("content")})
+	if err := s.adapter().Upload(stream); err != ErrOverloaded {
+		t.Errorf("got %v, want %v", err, ErrOverloaded)
+	}
+	if stream.received != 1 {
+		t.Errorf("received %d messages before failing, want 1", stream.received)
+	}
+}
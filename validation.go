@@ -0,0 +1,260 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validation error attached to a form field (Field contains several comma separated names
+// when the rule involves multiple fields).
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Fail when none of the keys has a value (nil and blank strings are considered as missing).
+func RequireOneOf(data Data, keys ...string) error {
+	for _, key := range keys {
+		if isPresent(data[key]) {
+			return nil
+		}
+	}
+	return FieldError{Field: strings.Join(keys, ","), Message: "one of these fields is required"}
+}
+
+// Fail when some of the keys have a value but not all.
+func RequireTogether(data Data, keys ...string) error {
+	var present, missing []string
+	for _, key := range keys {
+		if isPresent(data[key]) {
+			present = append(present, key)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	if len(present) == 0 || len(missing) == 0 {
+		return nil
+	}
+	return FieldError{Field: missing[0], Message: "required with " + strings.Join(present, ",")}
+}
+
+// Fail when the value of condKey is condVal (compared in its string form) and requiredKey is missing.
+func RequireIf(data Data, condKey string, condVal string, requiredKey string) error {
+	condValue := data[condKey]
+	if condValue == nil || fmt.Sprint(condValue) != condVal || isPresent(data[requiredKey]) {
+		return nil
+	}
+	return FieldError{Field: requiredKey, Message: "required when " + condKey + " is " + condVal}
+}
+
+// Read an uint64 which must be between minValue and maxValue (inclusive),
+// an absent value is an error (use a default value in the form to make it optional).
+func GetRangedUint64(data Data, key string, minValue uint64, maxValue uint64) (uint64, error) {
+	value := data[key]
+	if !isPresent(value) {
+		return 0, FieldError{Field: key, Message: "required"}
+	}
+	res, err := AsUint64(value)
+	if err != nil {
+		return 0, FieldError{Field: key, Message: err.Error()}
+	}
+	if res < minValue || res > maxValue {
+		return 0, FieldError{Field: key, Message: fmt.Sprintf("must be between %d and %d", minValue, maxValue)}
+	}
+	return res, nil
+}
+
+// Same as GetRangedUint64 for a float64.
+func GetRangedFloat64(data Data, key string, minValue float64, maxValue float64) (float64, error) {
+	value := data[key]
+	if !isPresent(value) {
+		return 0, FieldError{Field: key, Message: "required"}
+	}
+	res, err := AsFloat64(value)
+	if err != nil {
+		return 0, FieldError{Field: key, Message: err.Error()}
+	}
+	if !(res >= minValue && res <= maxValue) {
+		// written to also reject NaN
+		return 0, FieldError{Field: key, Message: fmt.Sprintf("must be between %g and %g", minValue, maxValue)}
+	}
+	return res, nil
+}
+
+func isPresent(value any) bool {
+	if value == nil {
+		return false
+	}
+	if s, ok := value.(string); ok {
+		return strings.TrimSpace(s) != ""
+	}
+	return true
+}
+
+// Rule check a value and return an error message (empty when the value is valid),
+// except Required the rules accept absent values (nil or blank strings).
+type Rule func(value any) string
+
+// Rules associate data keys to the rules checked by Validate.
+type Rules map[string][]Rule
+
+// Check data against rules and return the message of the first failing rule of each key
+// (nil when everything is valid), intended to be merged into the template data
+// to render the form again with the messages next to the fields.
+func Validate(data Data, rules Rules) map[string]string {
+	var res map[string]string
+	for key, keyRules := range rules {
+		value := data[key]
+		for _, rule := range keyRules {
+			if message := rule(value); message != "" {
+				if res == nil {
+					res = map[string]string{}
+				}
+				res[key] = message
+				break
+			}
+		}
+	}
+	return res
+}
+
+// Validate the "formData" entry of data (the submitted form), see Validate.
+func ValidateForm(data Data, rules Rules) (map[string]string, error) {
+	formData, err := GetFormData(data)
+	if err != nil {
+		return nil, err
+	}
+	return Validate(formData, rules), nil
+}
+
+func Required() Rule {
+	return func(value any) string {
+		if isPresent(value) {
+			return ""
+		}
+		return "required"
+	}
+}
+
+// The length is counted in characters (not bytes).
+func MinLength(length int) Rule {
+	return stringRule(func(s string) string {
+		if utf8.RuneCountInString(s) >= length {
+			return ""
+		}
+		return fmt.Sprintf("must contain at least %d characters", length)
+	})
+}
+
+// The length is counted in characters (not bytes).
+func MaxLength(length int) Rule {
+	return stringRule(func(s string) string {
+		if utf8.RuneCountInString(s) <= length {
+			return ""
+		}
+		return fmt.Sprintf("must contain at most %d characters", length)
+	})
+}
+
+// Accept a bare email address (without display name).
+func Email() Rule {
+	return stringRule(func(s string) string {
+		if address, err := mail.ParseAddress(s); err == nil && address.Address == s {
+			return ""
+		}
+		return "must be a valid email address"
+	})
+}
+
+// The whole value must match re, message is returned otherwise.
+func Pattern(re *regexp.Regexp, message string) Rule {
+	// anchored to also match "ab" with "a|ab" (the leftmost match would be "a")
+	whole := regexp.MustCompile("^(?:" + re.String() + ")$")
+	return stringRule(func(s string) string {
+		if whole.MatchString(s) {
+			return ""
+		}
+		return message
+	})
+}
+
+func OneOf(values ...string) Rule {
+	return stringRule(func(s string) string {
+		if contains(values, s) {
+			return ""
+		}
+		return "must be one of " + strings.Join(values, ", ")
+	})
+}
+
+// Numeric values (converted with AsFloat64) must be greater than or equal to minValue.
+func Min(minValue float64) Rule {
+	return floatRule(func(f float64) string {
+		if f >= minValue {
+			return ""
+		}
+		return fmt.Sprintf("must be at least %g", minValue)
+	})
+}
+
+// Numeric values (converted with AsFloat64) must be less than or equal to maxValue.
+func Max(maxValue float64) Rule {
+	return floatRule(func(f float64) string {
+		if f <= maxValue {
+			return ""
+		}
+		return fmt.Sprintf("must be at most %g", maxValue)
+	})
+}
+
+func stringRule(check func(string) string) Rule {
+	return func(value any) string {
+		if !isPresent(value) {
+			return ""
+		}
+		s, err := AsString(value)
+		if err != nil {
+			return err.Error()
+		}
+		return check(strings.TrimSpace(s))
+	}
+}
+
+func floatRule(check func(float64) string) Rule {
+	return func(value any) string {
+		if !isPresent(value) {
+			return ""
+		}
+		f, err := AsFloat64(value)
+		if err != nil || math.IsNaN(f) {
+			return "must be a number"
+		}
+		return check(f)
+	}
+}
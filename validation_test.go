@@ -0,0 +1,170 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestCrossFieldRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(Data) error
+		data  Data
+		want  error
+	}{
+		{
+			name:  "one of with the first",
+			check: func(data Data) error { return RequireOneOf(data, "phone", "email") },
+			data:  Data{"phone": "0102030405"},
+		},
+		{
+			name:  "one of with the second",
+			check: func(data Data) error { return RequireOneOf(data, "phone", "email") },
+			data:  Data{"phone": " ", "email": "a@b.test"},
+		},
+		{
+			name:  "one of with none",
+			check: func(data Data) error { return RequireOneOf(data, "phone", "email") },
+			data:  Data{"phone": ""},
+			want:  FieldError{Field: "phone,email", Message: "one of these fields is required"},
+		},
+		{
+			name:  "together with all",
+			check: func(data Data) error { return RequireTogether(data, "start", "end") },
+			data:  Data{"start": "1", "end": "2"},
+		},
+		{
+			name:  "together with none",
+			check: func(data Data) error { return RequireTogether(data, "start", "end") },
+			data:  Data{},
+		},
+		{
+			name:  "together with some",
+			check: func(data Data) error { return RequireTogether(data, "start", "end") },
+			data:  Data{"start": "1"},
+			want:  FieldError{Field: "end", Message: "required with start"},
+		},
+		{
+			name:  "if with the condition and the field",
+			check: func(data Data) error { return RequireIf(data, "country", "US", "state") },
+			data:  Data{"country": "US", "state": "CA"},
+		},
+		{
+			name:  "if without the condition",
+			check: func(data Data) error { return RequireIf(data, "country", "US", "state") },
+			data:  Data{"country": "FR"},
+		},
+		{
+			name:  "if with the condition without the field",
+			check: func(data Data) error { return RequireIf(data, "country", "US", "state") },
+			data:  Data{"country": "US"},
+			want:  FieldError{Field: "state", Message: "required when country is US"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.check(tt.data); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRangedUint64(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		want    uint64
+		wantErr error
+	}{
+		{name: "inside", value: float64(5), want: 5},
+		{name: "string", value: "7", want: 7},
+		{name: "lower bound", value: float64(1), want: 1},
+		{name: "upper bound", value: float64(10), want: 10},
+		{name: "below", value: float64(0), wantErr: FieldError{Field: "count", Message: "must be between 1 and 10"}},
+		{name: "above", value: float64(11), wantErr: FieldError{Field: "count", Message: "must be between 1 and 10"}},
+		{name: "negative", value: float64(-1), wantErr: FieldError{Field: "count", Message: errNegative.Error()}},
+		{name: "absent", wantErr: FieldError{Field: "count", Message: "required"}},
+		{name: "blank", value: " ", wantErr: FieldError{Field: "count", Message: "required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetRangedUint64(Data{"count": tt.value}, "count", 1, 10)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRangedFloat64(t *testing.T) {
+	rangeErr := FieldError{Field: "ratio", Message: "must be between 0 and 1.5"}
+	tests := []struct {
+		name    string
+		value   any
+		want    float64
+		wantErr error
+	}{
+		{name: "inside", value: 0.5, want: 0.5},
+		{name: "string", value: "1.25", want: 1.25},
+		{name: "lower bound", value: float64(0), want: 0},
+		{name: "upper bound", value: 1.5, want: 1.5},
+		{name: "below", value: -0.1, wantErr: rangeErr},
+		{name: "above", value: 1.6, wantErr: rangeErr},
+		{name: "not a number", value: "NaN", wantErr: rangeErr},
+		{name: "absent", wantErr: FieldError{Field: "ratio", Message: "required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetRangedFloat64(Data{"ratio": tt.value}, "ratio", 0, 1.5)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   any
+		want    string
+	}{
+		{pattern: `[a-z]+`, value: "abc"},
+		{pattern: `[a-z]+`, value: "abc1", want: "invalid"},
+		{pattern: `[a-z]+`, value: "1abc", want: "invalid"},
+		{pattern: `a|ab`, value: "ab"},
+		{pattern: `^[0-9]{5}$`, value: "75001"},
+		{pattern: `(?i)abc`, value: "ABC"},
+		{pattern: `[a-z]+`, value: ""},
+	}
+	for _, tt := range tests {
+		if got := Pattern(regexp.MustCompile(tt.pattern), "invalid")(tt.value); got != tt.want {
+			t.Errorf("Pattern(%q) on %q = %q, want %q", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
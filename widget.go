@@ -0,0 +1,276 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"github.com/uptrace/opentelemetry-go-extra/otelzap"
+	"go.uber.org/zap"
+)
+
+var ErrDuplicateAction = errors.New("action already registered")
+
+// DuplicatePolicy indicate what AddAction (and its variants) do when the widget
+// already has an action with the same name.
+type DuplicatePolicy int
+
+const (
+	DuplicateOverwrite DuplicatePolicy = iota // silently replace the action (the default)
+	DuplicateLog                              // replace the action with a warning
+	DuplicatePanic                            // panic, to catch wiring mistakes at startup
+)
+
+type action struct {
+	kind          pb.MethodKind
+	path          string
+	queryNames    []string
+	handler       ActionHandler
+	stream        StreamHandler
+	flag          string
+	timeout       time.Duration
+	longPolling   bool
+	dedupTTL      time.Duration
+	maxFileSize   int64
+	fileTypes     []string
+	description   string
+	required      []string
+	pathParams    []string
+	csrf          bool
+	authenticated bool
+	roles         []roleRequirement
+	rateLimit     *actionRateLimit
+	heavy         bool
+	audited       bool
+}
+
+// ActionOption configure an action at registration.
+type ActionOption func(*action)
+
+// ActionMiddleware wrap an handler to add a cross-cutting behavior (auth, logging, timing, etc.).
+type ActionMiddleware = func(ActionHandler) ActionHandler
+
+// state shared by a WidgetServer and its widgets, the lock allow to register or remove
+// widgets and actions while the server is running
+type registry struct {
+	lock        sync.RWMutex
+	widgets     map[string]Widget
+	middlewares []ActionMiddleware
+	jobs        *jobStore
+	scheduler   *scheduler
+	submissions *submissionGroup
+}
+
+// Widget is a handle on the registered actions of a widget, copies share the same registration.
+type Widget struct {
+	*widgetState
+}
+
+type widgetState struct {
+	lock        *sync.RWMutex // shared with the WidgetServer
+	logger      *otelzap.Logger
+	onDuplicate DuplicatePolicy
+	actions     map[string]action
+	middlewares []ActionMiddleware
+	description string
+	jobs        *jobStore
+	scheduler   *scheduler
+	cached      atomic.Pointer[cachedWidget]
+}
+
+// Description of a registered action (without its handler).
+type ActionInfo struct {
+	Name           string
+	Kind           pb.MethodKind
+	Path           string
+	QueryNames     []string
+	PathParams     []string
+	Description    string
+	RequiredParams []string
+}
+
+type WidgetInfo struct {
+	Name        string
+	Description string
+	Actions     []ActionInfo
+}
+
+// based on gin path convention, with the path "/view/:id/:name"
+// the map passed to handler will contains "pathData/id" and "pathData/name" entries
+// (an invalid path is a wiring mistake and cause a panic with an error wrapping ErrInvalidPath,
+// see ParsePathParams and TryAddAction)
+// handler returned values are supposed to be redirect, templateName and data :
+//
+//  1. redirect is a redirect path (ignored if empty), to build an absolute one on the site the map contains the "CurrentUrl" entry
+//
+//  2. data could be :
+//
+//     - a json marshalled map which entries will be added to the data passed to the template engine with templateName
+//
+//     - or any raw data when the action kind is pb.MethodKind_RAW
+func (w Widget) AddAction(actionName string, kind pb.MethodKind, path string, handler ActionHandler, opts ...ActionOption) {
+	w.addAction(actionName, action{kind: kind, path: path, handler: handler}, opts)
+}
+
+// Like AddAction but allow to indicate which query parameters should be transmitted.
+func (w Widget) AddActionWithQuery(actionName string, kind pb.MethodKind, path string, queryNames []string, handler ActionHandler, opts ...ActionOption) {
+	w.addAction(actionName, action{kind: kind, path: path, queryNames: queryNames, handler: handler}, opts)
+}
+
+// Like AddActionWithQuery but with a description and the names of the parameters the frontend
+// must provide, both sent by GetWidget (see SetDescription) to generate help pages and validate calls.
+func (w Widget) AddActionWithInfo(actionName string, kind pb.MethodKind, path string, queryNames []string, description string, requiredParams []string, handler ActionHandler, opts ...ActionOption) {
+	w.addAction(actionName, action{
+		kind: kind, path: path, queryNames: queryNames, handler: handler, description: description, required: requiredParams,
+	}, opts)
+}
+
+// Set the description of the widget, sent by GetWidget in the "puzzle-description-bin" header
+// metadata along with the descriptions of the actions.
+func (w Widget) SetDescription(description string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.description = description
+	w.invalidateResponse()
+}
+
+// Like AddAction but return an error wrapping ErrDuplicateAction (without replacing anything)
+// when the widget already has an action with the same name, or wrapping ErrInvalidPath.
+func (w Widget) TryAddAction(actionName string, kind pb.MethodKind, path string, handler ActionHandler, opts ...ActionOption) error {
+	return w.tryAddAction(actionName, action{kind: kind, path: path, handler: handler}, opts)
+}
+
+// duplicates are handled according to the DuplicatePolicy of the server
+func (w Widget) addAction(actionName string, a action, opts []ActionOption) {
+	pathParams, err := ParsePathParams(a.path)
+	if err != nil {
+		panic(err)
+	}
+	a.pathParams = pathParams
+	for _, opt := range opts {
+		opt(&a)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if _, ok := w.actions[actionName]; ok {
+		switch w.onDuplicate {
+		case DuplicatePanic:
+			panic(fmt.Errorf("%w : %s", ErrDuplicateAction, actionName))
+		case DuplicateLog:
+			w.logger.Warn("Replacing an already registered action", zap.String("action", actionName))
+		}
+	}
+	w.actions[actionName] = a
+	w.invalidateResponse()
+}
+
+func (w Widget) tryAddAction(actionName string, a action, opts []ActionOption) error {
+	pathParams, err := ParsePathParams(a.path)
+	if err != nil {
+		return err
+	}
+	a.pathParams = pathParams
+	for _, opt := range opts {
+		opt(&a)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if _, ok := w.actions[actionName]; ok {
+		return fmt.Errorf("%w : %s", ErrDuplicateAction, actionName)
+	}
+	w.actions[actionName] = a
+	w.invalidateResponse()
+	return nil
+}
+
+// Unregister an action, return false when the action is unknown.
+func (w Widget) RemoveAction(actionName string) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	_, ok := w.actions[actionName]
+	delete(w.actions, actionName)
+	w.invalidateResponse()
+	return ok
+}
+
+// Add middlewares applied to the handlers of this widget, in registration order
+// (after the ones of the WidgetServer).
+func (w Widget) Use(middlewares ...ActionMiddleware) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.middlewares = append(w.middlewares, middlewares...)
+}
+
+func applyMiddlewares(handler ActionHandler, middlewares []ActionMiddleware) ActionHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// should be called with the lock held
+func (w Widget) actionInfos() []ActionInfo {
+	infos := make([]ActionInfo, 0, len(w.actions))
+	for name, a := range w.actions {
+		// copies, so callers can not change the registration
+		infos = append(infos, ActionInfo{
+			Name: name, Kind: a.kind, Path: a.path, QueryNames: copyStrings(a.queryNames), PathParams: copyStrings(a.pathParams),
+			Description: a.description, RequiredParams: copyStrings(a.required),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+func copyStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string(nil), values...)
+}
+
+// snapshot of the registered widgets sorted by name
+func (r *registry) widgetInfos() []WidgetInfo {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	infos := make([]WidgetInfo, 0, len(r.widgets))
+	for name, widget := range r.widgets {
+		infos = append(infos, WidgetInfo{Name: name, Description: widget.description, Actions: widget.actionInfos()})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
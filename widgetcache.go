@@ -0,0 +1,64 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+)
+
+// GetWidget response of a widget, dropped when the widget changes
+type cachedWidget struct {
+	response    *pb.WidgetResponse
+	description []byte
+}
+
+// should be called with the lock held (read is enough),
+// the result can be cached when no action depends on a flag
+func (w Widget) buildResponse(widgetName string, mode TrailingSlashMode, filter func(action) bool) (*cachedWidget, bool, error) {
+	cacheable := true
+	actions := convertActions(w.actions, func(a action) bool {
+		if a.flag != "" {
+			cacheable = false
+		}
+		return filter(a)
+	})
+	for _, pbAction := range actions {
+		pbAction.Path = normalizePath(mode, pbAction.Path)
+	}
+
+	description, err := describeWidget(w, actions)
+	return &cachedWidget{response: &pb.WidgetResponse{Name: widgetName, Actions: actions}, description: description}, cacheable, err
+}
+
+// should be called with the lock held
+func (w Widget) invalidateResponse() {
+	w.cached.Store(nil)
+}
+
+// precompute the responses of the widgets whose actions do not depend on a flag
+func (r *registry) warmResponses(mode TrailingSlashMode) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for name, widget := range r.widgets {
+		if cached, cacheable, err := widget.buildResponse(name, mode, func(action) bool { return true }); err == nil && cacheable {
+			widget.cached.Store(cached)
+		}
+	}
+}
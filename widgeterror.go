@@ -0,0 +1,90 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"encoding/json"
+
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// data key of the user message when rendering an ErrorTemplate
+const errorMsgKey = "ErrorMsg"
+
+// WidgetError can be returned by an handler to control what the user see :
+// a redirect when Redirect is set, else the rendering of ErrorTemplate (with the UserMessage
+// as "ErrorMsg" in its data) when set and the action is not RAW, else a grpc status
+// with Code (default to codes.Internal) and UserMessage. UserMessage is resolved as a key
+// with the catalog of the server (see WithMessageCatalog).
+//
+// Err is the underlying cause, it is logged but never sent to the frontend.
+type WidgetError struct {
+	Code          codes.Code
+	UserMessage   string
+	ErrorTemplate string
+	Redirect      string
+	Err           error
+}
+
+func (e *WidgetError) Error() string {
+	if e.Err == nil {
+		return e.UserMessage
+	}
+	return e.UserMessage + ": " + e.Err.Error()
+}
+
+func (e *WidgetError) Unwrap() error {
+	return e.Err
+}
+
+func (s widgetServerAdapter) widgetErrorResponse(ctx context.Context, kind pb.MethodKind, widgetErr *WidgetError) (*pb.ProcessResponse, error) {
+	if widgetErr.Err != nil {
+		s.logger.WarnContext(ctx, "Handler returned an error", requestIdField(ctx), zap.Error(widgetErr.Err))
+	}
+
+	if widgetErr.Redirect != "" {
+		return &pb.ProcessResponse{Redirect: widgetErr.Redirect}, nil
+	}
+
+	userMessage := widgetErr.UserMessage
+	if userMessage != "" {
+		userMessage = Localize(ctx, userMessage)
+	}
+	if widgetErr.ErrorTemplate != "" && kind != pb.MethodKind_RAW {
+		resData, err := json.Marshal(Data{errorMsgKey: userMessage})
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to marshal error data", requestIdField(ctx), zap.Error(err))
+			return nil, s.internalError(ctx)
+		}
+		return &pb.ProcessResponse{TemplateName: widgetErr.ErrorTemplate, Data: resData}, nil
+	}
+
+	code := widgetErr.Code
+	if code == codes.OK {
+		code = codes.Internal
+	}
+	if userMessage == "" {
+		userMessage = s.internalMessage(ctx)
+	}
+	return nil, status.Error(code, userMessage)
+}
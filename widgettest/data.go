@@ -0,0 +1,89 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package widgettest
+
+import widgetserver "github.com/dvaumoron/puzzlewidgetserver"
+
+// Build the Data of a call with the keys used by the frontend :
+//
+//	data := widgettest.NewData().WithUser(42).WithPath("id", "7").WithQuery("pageSize", "20").Build()
+type DataBuilder struct {
+	data widgetserver.Data
+}
+
+func NewData() *DataBuilder {
+	return &DataBuilder{data: widgetserver.Data{}}
+}
+
+// Set the id of the connected user (the "Id" entry).
+func (b *DataBuilder) WithUser(userId uint64) *DataBuilder {
+	b.data[widgetserver.UserIdKey] = userId
+	return b
+}
+
+func (b *DataBuilder) WithCurrentUrl(currentUrl string) *DataBuilder {
+	b.data[widgetserver.CurrentUrlKey] = currentUrl
+	return b
+}
+
+func (b *DataBuilder) WithLocale(locale string) *DataBuilder {
+	b.data[widgetserver.LocaleKey] = locale
+	return b
+}
+
+// Add the fields of the submitted form (the "formData" entry).
+func (b *DataBuilder) WithForm(fields map[string]string) *DataBuilder {
+	for name, value := range fields {
+		b.WithFormValue(name, value)
+	}
+	return b
+}
+
+// Add a field to the submitted form, value can be a slice for a multiple field.
+func (b *DataBuilder) WithFormValue(name string, value any) *DataBuilder {
+	form, _ := b.data[widgetserver.FormKey].(widgetserver.Data)
+	if form == nil {
+		form = widgetserver.Data{}
+		b.data[widgetserver.FormKey] = form
+	}
+	form[name] = value
+	return b
+}
+
+// Set a path parameter (the "pathData/name" entry).
+func (b *DataBuilder) WithPath(name string, value string) *DataBuilder {
+	b.data[widgetserver.PathDataPrefix+name] = value
+	return b
+}
+
+// Set a query parameter (the "queryData/name" entry).
+func (b *DataBuilder) WithQuery(name string, value string) *DataBuilder {
+	b.data[widgetserver.QueryDataPrefix+name] = value
+	return b
+}
+
+// Set any other entry.
+func (b *DataBuilder) With(key string, value any) *DataBuilder {
+	b.data[key] = value
+	return b
+}
+
+func (b *DataBuilder) Build() widgetserver.Data {
+	return b.data
+}
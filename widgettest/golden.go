@@ -0,0 +1,129 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package widgettest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// when this environment variable is set to a non empty value, the golden files are (re)written
+const updateGoldenEnv = "WIDGETTEST_UPDATE_GOLDEN"
+
+// Compare the json data returned by an handler with the golden file at path, both are normalized
+// (indentation and sorted keys) and the test fails with a line diff when they differ.
+// Run the tests with WIDGETTEST_UPDATE_GOLDEN=1 to write the golden files.
+func AssertGoldenJson(tb testing.TB, path string, data []byte) {
+	tb.Helper()
+
+	actual, err := NormalizeJson(data)
+	if err != nil {
+		tb.Fatalf("invalid json data : %v", err)
+	}
+
+	if os.Getenv(updateGoldenEnv) != "" {
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err == nil {
+			err = os.WriteFile(path, actual, 0o644)
+		}
+		if err != nil {
+			tb.Fatalf("failed to write golden file %s : %v", path, err)
+		}
+		return
+	}
+
+	goldenData, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatalf("failed to read golden file %s (run with %s=1 to create it) : %v", path, updateGoldenEnv, err)
+	}
+	expected, err := NormalizeJson(goldenData)
+	if err != nil {
+		tb.Fatalf("invalid json in golden file %s : %v", path, err)
+	}
+	if string(actual) != string(expected) {
+		tb.Errorf("data differ from golden file %s (- golden, + actual) :\n%s", path, lineDiff(string(expected), string(actual)))
+	}
+}
+
+// Same as AssertGoldenJson with the data of an invoked templated action.
+func AssertGoldenResponse(tb testing.TB, path string, response Response) {
+	tb.Helper()
+
+	data, err := json.Marshal(response.Data)
+	if err != nil {
+		tb.Fatalf("failed to marshal response data : %v", err)
+	}
+	AssertGoldenJson(tb, path, data)
+}
+
+// Indent data with sorted keys, so equal json values give equal bytes.
+func NormalizeJson(data []byte) ([]byte, error) {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	normalized, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(normalized, '\n'), nil
+}
+
+// line oriented diff based on the longest common subsequence (fine for golden files size)
+func lineDiff(expected string, actual string) string {
+	expectedLines := strings.Split(expected, "\n")
+	actualLines := strings.Split(actual, "\n")
+
+	n, m := len(expectedLines), len(actualLines)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if expectedLines[i] == actualLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var builder strings.Builder
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && expectedLines[i] == actualLines[j]:
+			builder.WriteString("  " + expectedLines[i] + "\n")
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			builder.WriteString("- " + expectedLines[i] + "\n")
+			i++
+		default:
+			builder.WriteString("+ " + actualLines[j] + "\n")
+			j++
+		}
+	}
+	return builder.String()
+}
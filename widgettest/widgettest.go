@@ -0,0 +1,162 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Helpers to test widgets without grpc listener : the calls go through the same
+// code path as the ones received by a started server.
+package widgettest
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+
+	widgetserver "github.com/dvaumoron/puzzlewidgetserver"
+	pb "github.com/dvaumoron/puzzlewidgetservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const dataKey = "puzzledata.json"
+const headerPrefix = "puzzle-"
+
+// address of the fake caller (see widgetserver.GetClientIp)
+var clientAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 12345}
+
+// Result of an Invoke, the Response is filled according to the kind of the action :
+// Data for templated actions, Raw for RAW ones, ContentType and Status from the "puzzle-"
+// headers, Header contains all the header metadata set during the call.
+type Response struct {
+	widgetserver.Response
+	Header metadata.MD
+}
+
+type Server struct {
+	widgets widgetserver.WidgetServer
+	handler pb.WidgetServer
+}
+
+func NewServer(ws widgetserver.WidgetServer) Server {
+	return Server{widgets: ws, handler: ws.Handler()}
+}
+
+// Call GetWidget, returning the actions as the frontend see them.
+func (s Server) GetWidget(widgetName string) (*pb.WidgetResponse, error) {
+	return s.handler.GetWidget(context.Background(), &pb.WidgetRequest{Name: widgetName})
+}
+
+func (s Server) Invoke(widgetName string, actionName string, data widgetserver.Data, files map[string][]byte) (Response, error) {
+	return s.InvokeWithContext(context.Background(), widgetName, actionName, data, files)
+}
+
+// Like Invoke with a context (to pass incoming metadata or a deadline).
+func (s Server) InvokeWithContext(ctx context.Context, widgetName string, actionName string, data widgetserver.Data, files map[string][]byte) (Response, error) {
+	if data == nil {
+		data = widgetserver.Data{}
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return Response{}, err
+	}
+
+	// Process removes entries from the map
+	requestFiles := make(map[string][]byte, len(files)+1)
+	for name, content := range files {
+		requestFiles[name] = content
+	}
+	requestFiles[dataKey] = dataBytes
+
+	stream := &transportStream{method: "/puzzlewidgetservice.Widget/Process", header: metadata.MD{}}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	if _, ok := peer.FromContext(ctx); !ok {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: clientAddr})
+	}
+
+	pbResponse, err := s.handler.Process(ctx, &pb.ProcessRequest{
+		WidgetName: widgetName, ActionName: actionName, Files: requestFiles,
+	})
+	header := stream.copyHeader()
+	if err != nil {
+		return Response{Header: header}, err
+	}
+
+	response := Response{Header: header}
+	response.Redirect = pbResponse.Redirect
+	response.TemplateName = pbResponse.TemplateName
+	if s.isRaw(widgetName, actionName) {
+		response.Raw = pbResponse.Data
+	} else if len(pbResponse.Data) != 0 {
+		if err = json.Unmarshal(pbResponse.Data, &response.Data); err != nil {
+			return response, err
+		}
+	}
+	if values := header.Get(headerPrefix + "content-type"); len(values) != 0 {
+		response.ContentType = values[0]
+	}
+	if values := header.Get(headerPrefix + "status"); len(values) != 0 {
+		response.Status, _ = strconv.Atoi(values[0])
+	}
+	return response, nil
+}
+
+func (s Server) isRaw(widgetName string, actionName string) bool {
+	for _, info := range s.widgets.AllActions()[widgetName] {
+		if info.Name == actionName {
+			return info.Kind == pb.MethodKind_RAW
+		}
+	}
+	return false
+}
+
+// collect the header metadata set by the handlers (with grpc.SetHeader)
+type transportStream struct {
+	mutex  sync.Mutex
+	method string
+	header metadata.MD
+}
+
+func (s *transportStream) Method() string {
+	return s.method
+}
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, values := range md {
+		s.header[key] = append(s.header[key], values...)
+	}
+	return nil
+}
+
+func (s *transportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+func (s *transportStream) copyHeader() metadata.MD {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.header.Copy()
+}
@@ -0,0 +1,103 @@
+/*
+ *
+ * Copyright 2023 puzzlewidgetserver authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package puzzlewidgetserver
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+var errPoolStopped = errors.New("worker pool stopped")
+
+// bounded set of goroutines running the heavy actions, apart from the grpc ones
+type workerPool struct {
+	tasks    chan func()
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// Number of goroutines running the actions with Heavy (default to the number of CPUs).
+func WithHeavyWorkers(count int) Option {
+	return func(o *serverOptions) {
+		o.heavyWorkers = count
+	}
+}
+
+// Run the handler on the worker pool of the server (see WithHeavyWorkers) instead of the grpc goroutine of the call,
+// intended for CPU-heavy actions (PDF generation, image processing) to keep the other actions responsive.
+// The call waits for a free worker until its context is done, the handler must then stop using its data (see ActionTimeout).
+func Heavy() ActionOption {
+	return func(a *action) {
+		a.heavy = true
+	}
+}
+
+func newWorkerPool(count int) *workerPool {
+	if count <= 0 {
+		count = runtime.NumCPU()
+	}
+	pool := &workerPool{tasks: make(chan func()), quit: make(chan struct{})}
+	for i := 0; i < count; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+func (p *workerPool) work() {
+	for {
+		select {
+		case task := <-p.tasks:
+			task()
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+func (p *workerPool) stop() {
+	p.stopOnce.Do(func() {
+		close(p.quit)
+	})
+}
+
+// like callHandlerWithDeadline but the handler is called by a worker
+func (s widgetServerAdapter) callHandlerInPool(ctx context.Context, handler ActionHandler, data Data) (string, string, []byte, error) {
+	done := make(chan handlerResult, 1)
+	task := func() {
+		redirect, templateName, resData, err := s.callHandler(ctx, handler, data)
+		done <- handlerResult{redirect: redirect, templateName: templateName, resData: resData, err: err}
+	}
+
+	select {
+	case s.workers.tasks <- task:
+	case <-s.workers.quit:
+		return "", "", nil, errPoolStopped
+	case <-ctx.Done():
+		return "", "", nil, ctx.Err()
+	}
+
+	select {
+	case res := <-done:
+		return res.redirect, res.templateName, res.resData, res.err
+	case <-ctx.Done():
+		return "", "", nil, ctx.Err()
+	}
+}